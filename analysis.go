@@ -0,0 +1,703 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"arduino.cc/builder/types"
+)
+
+// State shared by the analysis of all the libraries of a run
+type analysis struct {
+	ctx            *types.Context
+	indexJson      *indexOutput
+	previousRun    *indexLibrariesAnalyzed
+	sketchTemplate string
+	folderLocks    folderLocks
+	// libraries folders given with -support-libraries
+	supportFolders []string
+
+	// no library is started after the deadline, if set
+	deadline time.Time
+	// libraries not changed since then are skipped, if set
+	since time.Time
+
+	// serializes the saves of the results
+	saving sync.Mutex
+	// guards everything below, the index and the cache when running
+	// with -jobs
+	mutex sync.RWMutex
+
+	errors    *errorReport
+	stats     runStats
+	records   []dependencyRecord
+	stability []depStability
+	matched   []bool
+	analyzed  int
+	flushed   int
+	remaining int
+	// consecutive failures by architecture, for -max-failures
+	failureStreaks map[string]int
+	// why the run was aborted, if it was
+	aborted string
+}
+
+// safeTargets are the boards a sketch failing to compile is tried again on
+var safeTargets = []string{"arduino:avr:uno", "arduino:avr:mega:cpu=atmega2560"}
+
+// build compiles the sketch, retrying transient failures -build-retries
+// times. With -error-report, a failure keeps what the compiler printed
+// during the last attempt.
+func (a *analysis) build(ctx *types.Context) error {
+	if a.errors == nil {
+		return buildWithRetries(ctx, runBuilderSafely, *buildRetriesFlag, BUILD_RETRY_BACKOFF)
+	}
+	collector := &outputCollector{Logger: ctx.GetLogger()}
+	ctx.SetLogger(collector)
+	defer ctx.SetLogger(collector.Logger)
+	err := buildWithRetries(ctx, func(ctx *types.Context) error {
+		collector.output.Reset()
+		return runBuilderSafely(ctx)
+	}, *buildRetriesFlag, BUILD_RETRY_BACKOFF)
+	if err != nil {
+		return &buildFailure{err: err, output: collector.output.String()}
+	}
+	return nil
+}
+
+// imported returns the libraries used by the last build, as found in the
+// highest priority source, except the support libraries: those are only
+// recorded in result, if given, along with the versions used
+func (a *analysis) imported(ctx *types.Context, result *analysisResult) []*types.Library {
+	imported, support := splitSupportLibraries(resolveByPriority(ctx.ImportedLibraries, ctx.Libraries, librarySourcesByPriority(ctx)), a.supportFolders)
+	if result != nil {
+		result.SupportDeps = mergeDependencies(result.SupportDeps, support)
+		for _, dep := range imported {
+			if dep.Version == "" {
+				continue
+			}
+			if result.DepVersions == nil {
+				result.DepVersions = make(map[string]string)
+			}
+			result.DepVersions[strings.ToLower(dep.RealName)] = dep.Version
+		}
+	}
+	return imported
+}
+
+// analyzeDeclared takes the dependencies of a library from the 'depends' of
+// its library.properties, without compiling anything
+func (a *analysis) analyzeDeclared(library *types.Library, libIndex int) {
+	var deps []string
+	for _, dep := range parseDepends(library.Properties[LIBRARY_DEPENDS]) {
+		deps = append(deps, canonicalName(a.indexJson.Libraries, dep))
+	}
+	deps = a.checkIndexed(library, deps, make(map[string]bool))
+	fmt.Print("Library " + library.Name + " declares: ")
+	fmt.Println(deps)
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	result := analysisResult{Name: a.indexJson.Libraries[libIndex].LibraryName, Version: library.Version, Deps: deps, AllDeps: deps}
+	result.mergeInto(&a.indexJson.Libraries[libIndex])
+	a.records = append(a.records, result.records()...)
+	a.analyzed++
+}
+
+// importedDeps returns all the dependencies found by the last build alone
+func (a *analysis) importedDeps(ctx *types.Context, library *types.Library) []string {
+	deps, internalDeps := appendDependencies(a.imported(ctx, nil), library, ctx.OtherLibrariesFolders[0], a.indexJson.Libraries, nil, nil)
+	return mergeDependencies(deps, internalDeps)
+}
+
+// analyzeLibrarySafely runs analyzeLibrary, turning a panic into a failure
+// of that library only
+func (a *analysis) analyzeLibrarySafely(ctx *types.Context, library *types.Library) {
+	defer func() {
+		if r := recover(); r != nil {
+			fmt.Println("Analysis of " + library.Name + " failed: " + fmt.Sprint(r))
+			if ctx.Verbose {
+				fmt.Println(string(debug.Stack()))
+			}
+			a.fail(ctx, library, "panic", fmt.Errorf("%v", r))
+		}
+	}()
+	a.analyzeLibrary(ctx, library)
+}
+
+// fail records the failure of a library, which couldn't be analyzed
+func (a *analysis) fail(ctx *types.Context, library *types.Library, reason string, err error) {
+	a.mutex.Lock()
+	a.stats.Failed = append(a.stats.Failed, indexEntryRef{Name: library.RealName, Version: library.Version})
+	a.previousRun.Failed[failedCacheKey(library.RealName, library.Version)] = true
+	a.mutex.Unlock()
+	event := logEvent{Level: "error", Event: EVENT_FAILURE, Library: library.RealName, Version: library.Version, Message: reason}
+	if err != nil {
+		event.Message += ": " + err.Error()
+	}
+	events.log(event)
+	a.reportError(ctx, library, reason, err)
+}
+
+// reportError writes a failure to the -error-report file, if any
+func (a *analysis) reportError(ctx *types.Context, library *types.Library, reason string, err error) {
+	if a.errors == nil {
+		return
+	}
+	entry := errorReportEntry{
+		Name:    library.RealName,
+		Version: library.Version,
+		FQBN:    ctx.FQBN,
+		Arch:    archOfFQBN(ctx.FQBN),
+		Reason:  reason,
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	if failure, ok := err.(*buildFailure); ok {
+		entry.Output = failure.output
+	}
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if err := a.errors.Write(entry); err != nil {
+		fmt.Println(err.Error())
+	}
+}
+
+// checkDepsDelta warns if the number of dependencies of a library changed
+// more than -max-deps-delta since the loaded index: a core gone missing
+// usually shows up as libraries suddenly losing all their dependencies.
+func (a *analysis) checkDepsDelta(library *types.Library, before int, after int) {
+	delta := after - before
+	if delta < 0 {
+		delta = -delta
+	}
+	if delta > *maxDepsDelta {
+		fmt.Println("Warning: " + library.Name + " went from " + strconv.Itoa(before) + " to " + strconv.Itoa(after) + " dependencies")
+		warnings.add(WARNING_DEPS_DELTA_EXCEEDED, 1)
+		a.mutex.Lock()
+		defer a.mutex.Unlock()
+		a.stats.DepsDeltaExceeded = append(a.stats.DepsDeltaExceeded, indexEntryRef{Name: library.RealName, Version: library.Version})
+	}
+}
+
+func (a *analysis) appendIncludeReasons(ctx *types.Context, library *types.Library, reasons map[string][]string) map[string][]string {
+	reasons, err := appendIncludeReasons(ctx, library, a.indexJson.Libraries, reasons)
+	if err != nil {
+		fmt.Println("Cannot tell why the dependencies of " + library.Name + " were included: " + err.Error())
+	}
+	return reasons
+}
+
+// checkIndexed warns, once per dependency, about the dependencies provided
+// by the library manager that no index entry can satisfy. With
+// -flatten-requires they are renamed after the index entry they resolve to
+// first, and with -strict-requires the unresolved ones are dropped.
+func (a *analysis) checkIndexed(library *types.Library, deps []string, warned map[string]bool) []string {
+	if *flattenRequiresFlag {
+		var flattened []string
+		for _, dep := range deps {
+			name, ok := flattenedName(a.indexJson.Libraries, dep)
+			if ok && name != dep && *verboseFlag {
+				fmt.Println("Resolving " + dep + ", required by " + library.Name + ", to " + name)
+			}
+			if !sliceContainsFold(flattened, name) {
+				flattened = append(flattened, name)
+			}
+		}
+		deps = flattened
+	}
+	missing := notInIndex(a.indexJson.Libraries, deps)
+	for _, dep := range missing {
+		if !warned[dep] {
+			warned[dep] = true
+			fmt.Println("Warning: " + library.Name + " depends on " + dep + ", which is not in the index")
+			warnings.add(WARNING_DEPENDENCY_NOT_IN_INDEX, 1)
+		}
+	}
+	if *strictRequiresFlag {
+		return withoutDependencies(deps, missing)
+	}
+	return deps
+}
+
+func (a *analysis) skip(library *types.Library, reason string) {
+	fmt.Println("Skipping " + library.Name + ": " + reason)
+	a.recordSkip(library, reason)
+}
+
+// recordSkip only keeps track of a skip, for the frequent and expected ones
+// which would flood the output (cache hits and the like)
+func (a *analysis) recordSkip(library *types.Library, reason string) {
+	events.log(logEvent{Event: EVENT_SKIP, Library: library.RealName, Version: library.Version, Message: reason})
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.stats.Skipped = append(a.stats.Skipped, skippedLibrary{Name: library.RealName, Version: library.Version, Reason: reason})
+}
+
+// libraryArchs returns the architectures of the library left by
+// -include-archs and -exclude-archs
+func libraryArchs(library *types.Library) []string {
+	return filterArchs(allowArchs(library.Archs, splitList(*includeArchsFlag)), splitList(*excludeArchsFlag))
+}
+
+// willBuild tells if analyzeLibrary will compile the library, and for which
+// FQBN, going through the same checks without changing anything
+func (a *analysis) willBuild(library *types.Library) (string, bool) {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+	libIndex := indexJsonContains(a.indexJson.Libraries, library.RealName, library.Version)
+	if libIndex == -1 || *declaredOnlyFlag {
+		return "", false
+	}
+	failedBefore := a.previousRun.Failed[failedCacheKey(library.RealName, library.Version)]
+	if *onlyFailedFlag && !failedBefore {
+		return "", false
+	}
+	retry := *forceRebuild || *onlyFailedFlag
+	if !a.since.IsZero() && !retry && !failedBefore {
+		if newest, err := newestModTime(library.Folder); err == nil && newest.Before(a.since) {
+			return "", false
+		}
+	}
+	archs := libraryArchs(library)
+	if len(archs) == 0 || isPrecompiled(library) || hasNoSources(library) {
+		return "", false
+	}
+	fqbn, _ := resolveFQBN(library.Name, archs)
+	if retry {
+		return fqbn, true
+	}
+	resumed := *resumeFlag && len(a.indexJson.Libraries[libIndex].Requires) > 0
+	if a.previousRun.Exists[analyzedCacheKey(library.Name, fqbn)] || resumed {
+		return "", false
+	}
+	return fqbn, true
+}
+
+func (a *analysis) analyzeLibrary(ctx *types.Context, library *types.Library) {
+	indexJson := a.indexJson
+
+	a.mutex.RLock()
+	libIndex := indexJsonContains(indexJson.Libraries, library.RealName, library.Version)
+	a.mutex.RUnlock()
+
+	if libIndex == -1 {
+		// library not in index, don't create dependency tree
+		a.recordSkip(library, "not in index")
+		return
+	}
+	a.mutex.Lock()
+	failedBefore := a.previousRun.Failed[failedCacheKey(library.RealName, library.Version)]
+	a.matched[libIndex] = true
+	previousRequires := len(indexJson.Libraries[libIndex].Requires)
+	needsChecksum := *folderChecksumFlag && indexJson.Libraries[libIndex].Checksum == "" && indexJson.Libraries[libIndex].URL == ""
+	a.mutex.Unlock()
+
+	if *declaredOnlyFlag {
+		a.analyzeDeclared(library, libIndex)
+		return
+	}
+
+	if *onlyFailedFlag && !failedBefore {
+		a.recordSkip(library, "did not fail in the last run")
+		return
+	}
+	// failed libraries are analyzed again even if cached
+	retry := *forceRebuild || *onlyFailedFlag
+
+	// a library that failed may fail no more because of its dependencies,
+	// even if its own files didn't change
+	if !a.since.IsZero() && !retry && !failedBefore {
+		newest, err := newestModTime(library.Folder)
+		if err != nil {
+			fmt.Println("Cannot tell when " + library.Folder + " last changed: " + err.Error())
+		} else if newest.Before(a.since) {
+			a.recordSkip(library, "unchanged")
+			return
+		}
+	}
+
+	if needsChecksum {
+		checksum, err := folderChecksum(library.Folder, *checksumAlgoFlag)
+		if err != nil {
+			fmt.Println("Cannot compute checksum of " + library.Folder + ": " + err.Error())
+		} else {
+			a.mutex.Lock()
+			indexJson.Libraries[libIndex].Checksum = checksum
+			a.mutex.Unlock()
+		}
+	}
+
+	archs := allowArchs(library.Archs, splitList(*includeArchsFlag))
+	if len(archs) == 0 {
+		a.skip(library, "arch not in allow-list")
+		return
+	}
+	archs = filterArchs(archs, splitList(*excludeArchsFlag))
+	if len(archs) == 0 {
+		a.skip(library, "all architectures excluded")
+		return
+	}
+
+	if isPrecompiled(library) {
+		a.skip(library, "precompiled, dependencies not analyzed")
+		return
+	}
+
+	if hasNoSources(library) {
+		fmt.Println("Warning: " + library.Name + " has no headers and no examples, check its folder " + library.Folder)
+		warnings.add(WARNING_NO_SOURCES, 1)
+		a.skip(library, NO_SOURCES_STATUS)
+		return
+	}
+
+	fqbn, matchedFQBN := resolveFQBN(library.Name, archs)
+	if !matchedFQBN {
+		a.mutex.Lock()
+		a.stats.FQBNFallback = append(a.stats.FQBNFallback, indexEntryRef{Name: library.RealName, Version: library.Version})
+		a.mutex.Unlock()
+	}
+	cacheKey := analyzedCacheKey(library.Name, fqbn)
+
+	a.mutex.Lock()
+	cached := a.previousRun.Exists[cacheKey]
+	resumed := *resumeFlag && len(indexJson.Libraries[libIndex].Requires) > 0
+	if resumed && retry == false {
+		// the entry for this very version already lists its dependencies,
+		// consider it done and make the cache aware of it
+		a.previousRun.Exists[cacheKey] = true
+	}
+	a.mutex.Unlock()
+
+	if cached == true && retry == false {
+		// we already have analyzed the dependencies for this board, skip
+		// if forceRebuild == true or retrying failures, rebuild them anyway
+		a.recordSkip(library, "already analyzed for "+fqbn)
+		return
+	}
+
+	if resumed && retry == false {
+		a.recordSkip(library, "requires already in index")
+		return
+	}
+
+	// every build rescans the libraries folders: hold them until the
+	// analysis is over, and the one the library gets linked in exclusively,
+	// so that no other job sees the link
+	linkFolder := ""
+	if needsRealNameFolder(library) && !*isolateFlag && !*noSymlinkFlag && !isVersionedFolder(library) {
+		linkFolder = filepath.Dir(library.Folder)
+	}
+	release := a.folderLocks.hold(ctx.OtherLibrariesFolders, linkFolder)
+	defer release()
+
+	if linkFolder != "" {
+		staleSymlink, err := removeStaleSymlink(library)
+		if err != nil {
+			fmt.Println("Cannot remove stale symlink to " + library.Folder + ": " + err.Error())
+		} else if staleSymlink != "" {
+			fmt.Println("removed stale symlink " + staleSymlink)
+		}
+	}
+
+	if *isolateFlag || (*noSymlinkFlag && needsRealNameFolder(library)) {
+		// copy the library to a private libraries folder, under its RealName.
+		// With -no-symlink this is the only way to show it to the builder
+		// under the right name.
+		isolatedFolder, err := isolateLibrary(library)
+		if err != nil {
+			fmt.Println("Cannot isolate " + library.Name + ": " + err.Error())
+			a.fail(ctx, library, "cannot isolate library", err)
+			return
+		}
+		defer os.RemoveAll(isolatedFolder)
+
+		otherLibrariesFolders := ctx.OtherLibrariesFolders
+		ctx.OtherLibrariesFolders = append(append([]string{}, otherLibrariesFolders...), isolatedFolder)
+		defer func() { ctx.OtherLibrariesFolders = otherLibrariesFolders }()
+	} else if needsRealNameFolder(library) && isVersionedFolder(library) {
+		// other versions may be installed next to it: a link named RealName
+		// in the libraries folder would collide with theirs
+		privateFolder, err := symlinkToPrivateFolder(library)
+		if err != nil {
+			fmt.Println("Cannot symlink " + library.Folder + ": " + err.Error())
+			a.fail(ctx, library, "cannot symlink versioned folder", err)
+			return
+		}
+		defer os.RemoveAll(privateFolder)
+		fmt.Println("symlinking versioned folder " + library.Folder + " from " + privateFolder)
+
+		otherLibrariesFolders := ctx.OtherLibrariesFolders
+		ctx.OtherLibrariesFolders = append(append([]string{}, otherLibrariesFolders...), privateFolder)
+		defer func() { ctx.OtherLibrariesFolders = otherLibrariesFolders }()
+	} else {
+		// symlink the folder to a folder called RealName so it gets picked up
+		symlinkWithBestName, err := symlinkToRealName(library)
+		if err != nil {
+			fmt.Println("Cannot symlink " + library.Folder + ": " + err.Error())
+		} else if symlinkWithBestName != "" {
+			createdSymlinks.add(symlinkWithBestName)
+			defer func() {
+				os.Remove(symlinkWithBestName)
+				createdSymlinks.remove(symlinkWithBestName)
+			}()
+			fmt.Println("symlinking " + library.Folder + " to " + symlinkWithBestName)
+		}
+	}
+
+	ctx.FQBN = fqbn
+	events.log(logEvent{Event: EVENT_START, Library: library.RealName, Version: library.Version, Message: "analyzing for " + fqbn})
+
+	defer func() {
+		if err := cleanBuildLibraries(ctx.BuildPath); err != nil {
+			fmt.Println("Cannot clean the build folder after " + library.Name + ": " + err.Error())
+		}
+	}()
+	if *verifyCleanFlag {
+		librariesFolders := append(append([]string{}, ctx.OtherLibrariesFolders...), ctx.BuiltInLibrariesFolders...)
+		before := snapshotFolders(librariesFolders)
+		defer func() {
+			changes := before.changes(snapshotFolders(librariesFolders))
+			if len(changes) > 0 {
+				fmt.Println("Warning: the libraries folders changed while analyzing " + library.Name + ":")
+				for _, change := range changes {
+					fmt.Println("  " + change)
+				}
+				warnings.add(WARNING_LIBRARIES_FOLDER_CHANGED, 1)
+			}
+		}()
+	}
+
+	//wipe ctx.UsedLibraries
+	ctx.ImportedLibraries = ctx.ImportedLibraries[:0]
+	ctx.IncludeFolders = ctx.IncludeFolders[:0]
+
+	// create sketch, including all library headers
+	tempDir, err := sketchFolder(*workDirFlag, library)
+	if err != nil {
+		fmt.Println("Cannot create the sketch folder of " + library.Name + ": " + err.Error())
+	}
+
+	ctx.SketchLocation, _ = filepath.Abs(filepath.Join(tempDir, sketchFileName(library)))
+
+	include, headerMatch := includeHeadersFromLibraryFolder(library)
+	a.mutex.Lock()
+	a.stats.countHeaderMatch(headerMatch)
+	a.mutex.Unlock()
+	sketch := renderSketch(a.sketchTemplate, prependDefines(sketchDefinesFlag, prependIncludes(prependIncludesFlag, include)))
+
+	ioutil.WriteFile(ctx.SketchLocation, []byte(sketch), 0666)
+
+	if *sketchOutFlag != "" {
+		if err := dumpSketch(*sketchOutFlag, library, sketch); err != nil {
+			fmt.Println("Cannot keep the sketch of " + library.Name + ": " + err.Error())
+		}
+	}
+
+	a.mutex.Lock()
+	result := analysisResult{Name: indexJson.Libraries[libIndex].LibraryName, Version: library.Version}
+	a.mutex.Unlock()
+	started := time.Now()
+
+	err = a.build(ctx)
+
+	tries := 0
+	for err != nil && tries < len(safeTargets) {
+		// try recompling for safer targets
+		ctx.FQBN = safeTargets[tries]
+		tries++
+		err = a.build(ctx)
+	}
+
+	var deps []string
+	var internal_deps []string
+	warnedDeps := make(map[string]bool)
+
+	deps, internal_deps = appendDependencies(a.imported(ctx, &result), library, ctx.OtherLibrariesFolders[0], indexJson.Libraries, deps, internal_deps)
+	deps = a.checkIndexed(library, deps, warnedDeps)
+	if *withIncludeReasonsFlag {
+		result.IncludeReasons = a.appendIncludeReasons(ctx, library, result.IncludeReasons)
+	}
+	if *depStabilityFlag != "" {
+		result.Units = append(result.Units, a.importedDeps(ctx, library))
+	}
+
+	// libraries working everywhere may pull other dependencies on other
+	// architectures
+	starFQBNs, unknownStarArchs := starArchFQBNs(library.Name, archs, splitList(*starArchsFlag), ctx.FQBN)
+	if len(unknownStarArchs) > 0 && ctx.Verbose {
+		fmt.Println("No board known for architectures " + strings.Join(unknownStarArchs, ", ") + ", not compiling " + library.Name + " for them")
+	}
+	compiledFQBN := ctx.FQBN
+	for _, starFQBN := range starFQBNs {
+		ctx.FQBN = starFQBN
+		ctx.ImportedLibraries = ctx.ImportedLibraries[:0]
+		ctx.IncludeFolders = ctx.IncludeFolders[:0]
+		if starErr := a.build(ctx); starErr != nil {
+			a.reportError(ctx, library, failureReason(starErr, "sketch failed to compile on "+starFQBN), starErr)
+		}
+		deps, internal_deps = appendDependencies(a.imported(ctx, &result), library, ctx.OtherLibrariesFolders[0], indexJson.Libraries, deps, internal_deps)
+		deps = a.checkIndexed(library, deps, warnedDeps)
+		if *withIncludeReasonsFlag {
+			result.IncludeReasons = a.appendIncludeReasons(ctx, library, result.IncludeReasons)
+		}
+		if *depStabilityFlag != "" {
+			result.Units = append(result.Units, a.importedDeps(ctx, library))
+		}
+	}
+	ctx.FQBN = compiledFQBN
+
+	a.mutex.Lock()
+	needsSupportLevel := *computeSupportLevelFlag && indexJson.Libraries[libIndex].SupportLevel == ""
+	a.mutex.Unlock()
+	if needsSupportLevel {
+		result.SupportLevel = computeSupportLevel(ctx, library.Name, archs)
+	}
+
+	if *workDirFlag == "" {
+		os.RemoveAll(tempDir)
+	}
+
+	//ctx.Libraries[i].Dependencies = deps
+
+	fmt.Print("Library " + library.Name + " depends on: ")
+	fmt.Print(deps)
+	fmt.Print(" provided by lib manager and ")
+	fmt.Print(internal_deps)
+	fmt.Print(" provided by cores or builtin")
+
+	result.FQBN = ctx.FQBN
+	result.AnalyzedWith = platformOf(ctx)
+	result.Failed = err != nil
+	if result.Failed {
+		fmt.Println(" but failed to compile on " + ctx.FQBN)
+		a.fail(ctx, library, failureReason(err, "sketch failed to compile"), err)
+	} else {
+		fmt.Println("")
+	}
+	result.Deps, result.InternalDeps = deps, internal_deps
+	result.SketchDeps = mergeDependencies(deps, internal_deps)
+	result.WithEvidence = *withEvidenceFlag
+
+	backup_fqbn := ""
+
+	// search for examples
+	examples := findExamples(library)
+	examplesFallback := needsExamplesFallback(deps, internal_deps, examples)
+
+	if (*exampleFlag || examplesFallback) && err != nil && *skipExamplesOnFailure {
+		fmt.Println("Skipping examples for " + library.Name + " since it failed to compile")
+	} else if *exampleFlag || examplesFallback {
+
+		var errors_examples []string
+		// what the examples pull by themselves, for the report only
+		var example_deps []string
+		var example_internal_deps []string
+
+		for _, example := range examples {
+			ctx.SketchLocation = example
+			ctx.ImportedLibraries = ctx.ImportedLibraries[:0]
+			ctx.IncludeFolders = ctx.IncludeFolders[:0]
+
+			if strings.Contains(strings.ToUpper(ctx.SketchLocation), "YUN") {
+				backup_fqbn = ctx.FQBN
+				ctx.FQBN = "arduino:avr:yun"
+			} else if backup_fqbn != "" {
+				ctx.FQBN = backup_fqbn
+			}
+
+			err = a.build(ctx)
+
+			if err != nil {
+				errors_examples = append(errors_examples, err.Error())
+				a.reportError(ctx, library, failureReason(err, "example "+filepath.Base(example)+" failed to compile"), err)
+			}
+
+			deps, internal_deps = appendDependencies(a.imported(ctx, &result), library, ctx.OtherLibrariesFolders[0], indexJson.Libraries, deps, internal_deps)
+			deps = a.checkIndexed(library, deps, warnedDeps)
+			example_deps, example_internal_deps = appendDependencies(a.imported(ctx, &result), library, ctx.OtherLibrariesFolders[0], indexJson.Libraries, example_deps, example_internal_deps)
+			if *withIncludeReasonsFlag {
+				result.IncludeReasons = a.appendIncludeReasons(ctx, library, result.IncludeReasons)
+			}
+			if *depStabilityFlag != "" {
+				result.Units = append(result.Units, a.importedDeps(ctx, library))
+			}
+		}
+		fmt.Print("Examples for " + library.Name + " depend on: ")
+		fmt.Print(example_deps)
+		fmt.Print(" provided by lib manager and ")
+		fmt.Print(example_internal_deps)
+		fmt.Print(" provided by cores or builtin")
+
+		result.ExamplesCompiled = *exampleFlag
+		result.ExampleDeps = mergeDependencies(example_deps, example_internal_deps)
+
+		if len(errors_examples) > 0 {
+			fmt.Println(" but " + strconv.Itoa(len(errors_examples)) + " failed to compile on " + ctx.FQBN)
+			// fmt.Println(errors_examples)
+		} else {
+			fmt.Println("")
+		}
+
+		if examplesFallback {
+			fmt.Println("Headers of " + library.Name + " don't pull any dependency, using the ones found by its examples")
+			result.Deps, result.InternalDeps = deps, internal_deps
+		}
+
+	}
+	result.AllDeps, result.AllInternalDeps = deps, internal_deps
+	result.Duration = time.Since(started)
+
+	a.mutex.Lock()
+	result.mergeInto(&indexJson.Libraries[libIndex])
+	requires := indexJson.Libraries[libIndex].Requires
+	a.mutex.Unlock()
+	events.log(logEvent{Event: EVENT_DEPS, Library: library.RealName, Version: library.Version, Deps: requires})
+	if *maxDepsDelta >= 0 {
+		a.checkDepsDelta(library, previousRequires, len(requires))
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.records = append(a.records, result.records()...)
+	a.stats.countInternalDeps(result.AllInternalDeps)
+	if *depStabilityFlag != "" {
+		a.stability = append(a.stability, result.stability())
+	}
+
+	a.previousRun.Exists[cacheKey] = true
+	if !result.Failed {
+		delete(a.previousRun.Failed, failedCacheKey(library.RealName, library.Version))
+	}
+	a.countFailure(result.FQBN, result.Failed)
+	a.analyzed++
+}
+
+// countFailure keeps the streak of failures of the architecture of fqbn,
+// aborting the run once -max-failures libraries in a row failed for it.
+// a.mutex must be held.
+func (a *analysis) countFailure(fqbn string, failed bool) {
+	if *maxFailuresFlag <= 0 {
+		return
+	}
+	arch := archOfFQBN(fqbn)
+	if !failed {
+		delete(a.failureStreaks, arch)
+		return
+	}
+	if a.failureStreaks == nil {
+		a.failureStreaks = make(map[string]int)
+	}
+	a.failureStreaks[arch]++
+	if a.failureStreaks[arch] >= *maxFailuresFlag && a.aborted == "" {
+		a.aborted = "the last " + strconv.Itoa(a.failureStreaks[arch]) + " libraries compiled for " + arch + " all failed, its core or toolchain is likely missing or broken"
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"time"
+
+	"arduino.cc/builder/constants"
+	"arduino.cc/builder/types"
+)
+
+// Compilation units a dependency was found by
+const EVIDENCE_SKETCH = "sketch"
+const EVIDENCE_EXAMPLE = "example"
+const EVIDENCE_BOTH = "both"
+
+// Everything the analysis of a library learned, before any of it is written
+// to the index. Exporters should take their data from here.
+type analysisResult struct {
+	Name    string
+	Version string
+	// the board the generated sketch was last compiled for
+	FQBN string
+	// the platform of that board, with its version
+	AnalyzedWith string
+	Failed       bool
+	// how long compiling the library and its examples took
+	Duration time.Duration
+
+	// the dependencies to be written as 'requires', provided by the library
+	// manager and by cores or builtin folders
+	Deps         []string
+	InternalDeps []string
+	// the dependencies found by any compilation unit, examples included
+	AllDeps         []string
+	AllInternalDeps []string
+	// the dependencies provided by -support-libraries, never written to the
+	// index
+	SupportDeps []string
+	// the version of every dependency the builder used, by lower case name
+	DepVersions map[string]string
+	// if the examples were compiled because of -examples
+	ExamplesCompiled bool
+	// all the dependencies found by the generated sketch and by the
+	// examples alone
+	SketchDeps  []string
+	ExampleDeps []string
+	// write which compilation units found every dependency, for
+	// -with-evidence
+	WithEvidence bool
+
+	// the dependencies found by every compilation unit, in order
+	Units          [][]string
+	IncludeReasons map[string][]string
+	SupportLevel   string
+}
+
+// mergeInto writes the result to its index entry. What the analysis didn't
+// compute is left untouched.
+func (r *analysisResult) mergeInto(entry *indexLibrary) {
+	entry.Requires = forceDependencies(r.Name, denyDependencies(r.Name, requiresList(r.Deps, r.InternalDeps)))
+	entry.RequiresVersions = r.DepVersions
+	if r.ExamplesCompiled {
+		entry.CouldRequire = requiresList(r.AllDeps, r.AllInternalDeps)
+	}
+	if r.IncludeReasons != nil {
+		entry.IncludeReasons = r.IncludeReasons
+	}
+	if r.SupportLevel != "" {
+		entry.SupportLevel = r.SupportLevel
+	}
+	if r.AnalyzedWith != "" {
+		entry.AnalyzedWith = r.AnalyzedWith
+	}
+	if r.WithEvidence {
+		entry.Evidence = r.evidence(entry.Requires)
+	}
+}
+
+// platformOf describes the platform the last build was made with, as in
+// "arduino:avr 1.6.19", or returns "" if the build didn't get that far
+func platformOf(ctx *types.Context) string {
+	if ctx.TargetPackage == nil || ctx.TargetPlatform == nil {
+		return ""
+	}
+	platform := ctx.TargetPackage.PackageId + ":" + ctx.TargetPlatform.PlatformId
+	if version := ctx.TargetPlatform.Properties[constants.PLATFORM_VERSION]; version != "" {
+		platform += " " + version
+	}
+	return platform
+}
+
+// evidence tells, for every dependency, if it was found by the generated
+// sketch, by the examples or by both
+func (r *analysisResult) evidence(deps []string) map[string]string {
+	evidence := make(map[string]string)
+	for _, dep := range deps {
+		bySketch, byExample := sliceContainsFold(r.SketchDeps, dep), sliceContainsFold(r.ExampleDeps, dep)
+		switch {
+		case bySketch && byExample:
+			evidence[dep] = EVIDENCE_BOTH
+		case bySketch:
+			evidence[dep] = EVIDENCE_SKETCH
+		case byExample:
+			evidence[dep] = EVIDENCE_EXAMPLE
+		}
+	}
+	return evidence
+}
+
+// records returns the rows of the -csv-out export
+func (r *analysisResult) records() []dependencyRecord {
+	records := dependencyRecords(r.Name, r.Version, r.AllDeps, r.AllInternalDeps)
+	for _, dep := range r.SupportDeps {
+		records = append(records, dependencyRecord{Name: r.Name, Version: r.Version, Dependency: dep, Kind: DEPENDENCY_KIND_SUPPORT})
+	}
+	return records
+}
+
+// stability returns the entry of the -dep-stability export
+func (r *analysisResult) stability() depStability {
+	return computeDepStability(r.Name, r.Version, r.Units)
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"testing"
+
+	"arduino.cc/builder/types"
+	"arduino.cc/properties"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAnalysisResultMergeInto(t *testing.T) {
+	entry := indexLibrary{LibraryName: "Display", Version: "1.0.0", Requires: []string{"Old"}, SupportLevel: "partial"}
+	result := analysisResult{
+		Name:            "Display",
+		Version:         "1.0.0",
+		Deps:            []string{"GFX"},
+		InternalDeps:    []string{"SPI"},
+		AllDeps:         []string{"GFX", "SD"},
+		AllInternalDeps: []string{"SPI"},
+	}
+
+	result.mergeInto(&entry)
+	require.Equal(t, []string{"GFX"}, entry.Requires)
+	require.Empty(t, entry.CouldRequire)
+	require.Equal(t, "partial", entry.SupportLevel)
+
+	result.ExamplesCompiled = true
+	result.SupportLevel = SUPPORT_LEVEL_VERIFIED
+	result.mergeInto(&entry)
+	require.Equal(t, []string{"GFX", "SD"}, entry.CouldRequire)
+	require.Equal(t, SUPPORT_LEVEL_VERIFIED, entry.SupportLevel)
+
+	require.Equal(t, []dependencyRecord{
+		{Name: "Display", Version: "1.0.0", Dependency: "GFX", Kind: DEPENDENCY_KIND_LIBMANAGER},
+		{Name: "Display", Version: "1.0.0", Dependency: "SD", Kind: DEPENDENCY_KIND_LIBMANAGER},
+		{Name: "Display", Version: "1.0.0", Dependency: "SPI", Kind: DEPENDENCY_KIND_INTERNAL},
+	}, result.records())
+}
+
+func TestAnalysisResultEvidence(t *testing.T) {
+	result := analysisResult{
+		Deps:         []string{"GFX", "SD"},
+		SketchDeps:   []string{"GFX", "SPI"},
+		ExampleDeps:  []string{"GFX", "SD"},
+		WithEvidence: true,
+	}
+	var entry indexLibrary
+	result.mergeInto(&entry)
+	require.Equal(t, map[string]string{"GFX": EVIDENCE_BOTH, "SD": EVIDENCE_EXAMPLE}, entry.Evidence)
+	require.Equal(t, map[string]string{"SPI": EVIDENCE_SKETCH}, result.evidence([]string{"SPI"}))
+}
+
+func TestPlatformOf(t *testing.T) {
+	require.Equal(t, "", platformOf(&types.Context{}))
+
+	ctx := &types.Context{
+		TargetPackage:  &types.Package{PackageId: "arduino"},
+		TargetPlatform: &types.Platform{PlatformId: "avr", Properties: properties.Map{"version": "1.6.19"}},
+	}
+	require.Equal(t, "arduino:avr 1.6.19", platformOf(ctx))
+
+	entry := indexLibrary{}
+	result := analysisResult{AnalyzedWith: platformOf(ctx)}
+	result.mergeInto(&entry)
+	require.Equal(t, "arduino:avr 1.6.19", entry.AnalyzedWith)
+}
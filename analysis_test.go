@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"arduino.cc/builder/i18n"
+	"arduino.cc/builder/types"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAnalyzeDeclared(t *testing.T) {
+	index := indexOutput{Libraries: []indexLibrary{{LibraryName: "Weather Station", Version: "0.3.0"}, {LibraryName: "SD", Version: "1.2.2"}}}
+	a := &analysis{indexJson: &index}
+	library := &types.Library{
+		Name:       "Weather_Station",
+		RealName:   "Weather Station",
+		Version:    "0.3.0",
+		Properties: map[string]string{LIBRARY_DEPENDS: "sd, Adafruit Unified Sensor (>=1.0.0)"},
+	}
+
+	a.analyzeDeclared(library, 0)
+	require.Equal(t, []string{"SD", "Adafruit Unified Sensor"}, index.Libraries[0].Requires)
+	require.Equal(t, 1, a.analyzed)
+	require.Len(t, a.records, 2)
+}
+
+func TestAnalysisRecordsFQBNFallback(t *testing.T) {
+	defer func(original func(*types.Context) error) { runBuilder = original }(runBuilder)
+	var fqbns []string
+	runBuilder = func(ctx *types.Context) error {
+		fqbns = append(fqbns, ctx.FQBN)
+		return nil
+	}
+
+	librariesFolder := filepath.Join("testdata", "libraries")
+	libraries := []*types.Library{
+		{Name: "SD", RealName: "SD", Version: "1.2.2", Folder: filepath.Join(librariesFolder, "SD"), Archs: []string{"megaavr"}},
+		{Name: "SpacedName", RealName: "SpacedName", Version: "1.0.0", Folder: filepath.Join(librariesFolder, "SpacedName"), Archs: []string{"samd"}},
+	}
+	index := indexOutput{Libraries: []indexLibrary{{LibraryName: "SD", Version: "1.2.2"}, {LibraryName: "SpacedName", Version: "1.0.0"}}}
+	previousRun := indexLibrariesAnalyzed{Exists: make(map[string]bool), Failed: make(map[string]bool)}
+	a := &analysis{
+		ctx:            &types.Context{OtherLibrariesFolders: []string{librariesFolder}},
+		indexJson:      &index,
+		previousRun:    &previousRun,
+		sketchTemplate: DEFAULT_SKETCH_TEMPLATE,
+		matched:        make([]bool, len(index.Libraries)),
+	}
+
+	require.NoError(t, a.analyzeLibraries(libraries, 1))
+	require.Equal(t, []string{DEFAULT_FQBN, "arduino:samd:mkr1000"}, fqbns)
+	require.Equal(t, []indexEntryRef{{Name: "SD", Version: "1.2.2"}}, a.stats.FQBNFallback)
+}
+
+func TestAnalysisFlushesWhileJobsRun(t *testing.T) {
+	defer func(original func(*types.Context) error) { runBuilder = original }(runBuilder)
+	runBuilder = func(ctx *types.Context) error { return nil }
+	defer func(original int) { *flushEvery = original }(*flushEvery)
+	*flushEvery = 1
+
+	librariesFolder, err := filepath.Abs(filepath.Join("testdata", "libraries"))
+	require.NoError(t, err)
+	// the cache is written to the working directory
+	workDir, err := ioutil.TempDir("", "flush")
+	require.NoError(t, err)
+	defer os.RemoveAll(workDir)
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(workDir))
+	defer os.Chdir(wd)
+	defer func(original string) { *outputFlag = original }(*outputFlag)
+	*outputFlag = filepath.Join(workDir, "library_index.json")
+
+	var libraries []*types.Library
+	index := indexOutput{}
+	for idx := 0; idx < 8; idx++ {
+		version := "1.0." + strconv.Itoa(idx)
+		libraries = append(libraries, &types.Library{Name: "SD" + strconv.Itoa(idx), RealName: "SD", Version: version, Folder: filepath.Join(librariesFolder, "SD"), Archs: []string{"avr"}})
+		index.Libraries = append(index.Libraries, indexLibrary{LibraryName: "SD", Version: version})
+	}
+	previousRun := indexLibrariesAnalyzed{Exists: make(map[string]bool), Failed: make(map[string]bool)}
+	a := &analysis{
+		ctx:            &types.Context{OtherLibrariesFolders: []string{librariesFolder}},
+		indexJson:      &index,
+		previousRun:    &previousRun,
+		sketchTemplate: DEFAULT_SKETCH_TEMPLATE,
+		matched:        make([]bool, len(index.Libraries)),
+	}
+
+	require.NoError(t, a.analyzeLibraries(libraries, 4))
+	require.Equal(t, len(libraries), a.flushed)
+
+	var saved indexOutput
+	data, err := ioutil.ReadFile(*outputFlag)
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(data, &saved))
+	require.Len(t, saved.Libraries, len(libraries))
+	var cache indexLibrariesAnalyzed
+	data, err = ioutil.ReadFile(filepath.Join(workDir, CACHED_RESULTS_FILE))
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(data, &cache))
+	require.Len(t, cache.Exists, len(libraries))
+}
+
+func TestAnalysisRecordsDependencyVersions(t *testing.T) {
+	librariesFolder := filepath.Join("testdata", "libraries")
+	sd := &types.Library{Name: "SD", RealName: "SD", Version: "1.2.2", Folder: filepath.Join(librariesFolder, "SD")}
+	defer func(original func(*types.Context) error) { runBuilder = original }(runBuilder)
+	runBuilder = func(ctx *types.Context) error {
+		ctx.ImportedLibraries = []*types.Library{sd}
+		return nil
+	}
+
+	library := &types.Library{Name: "TemplateOnly", RealName: "TemplateOnly", Version: "1.0.0", Folder: filepath.Join(librariesFolder, "TemplateOnly"), Archs: []string{"avr"}}
+	index := indexOutput{Libraries: []indexLibrary{{LibraryName: "TemplateOnly", Version: "1.0.0"}, {LibraryName: "SD", Version: "1.3.0"}}}
+	previousRun := indexLibrariesAnalyzed{Exists: make(map[string]bool), Failed: make(map[string]bool)}
+	a := &analysis{
+		ctx:            &types.Context{OtherLibrariesFolders: []string{librariesFolder}},
+		indexJson:      &index,
+		previousRun:    &previousRun,
+		sketchTemplate: DEFAULT_SKETCH_TEMPLATE,
+		matched:        make([]bool, len(index.Libraries)),
+	}
+
+	require.NoError(t, a.analyzeLibraries([]*types.Library{library}, 1))
+	require.Equal(t, []string{"SD (>=1.2.2)"}, constrainedIndex(&index).Libraries[0].Requires)
+}
+
+func TestSinceDoesNotSkipFailedLibraries(t *testing.T) {
+	defer func(original func(*types.Context) error) { runBuilder = original }(runBuilder)
+	runBuilder = func(ctx *types.Context) error { return nil }
+
+	librariesFolder := filepath.Join("testdata", "libraries")
+	libraries := []*types.Library{
+		{Name: "SD", RealName: "SD", Version: "1.2.2", Folder: filepath.Join(librariesFolder, "SD"), Archs: []string{"avr"}},
+		{Name: "TemplateOnly", RealName: "TemplateOnly", Version: "1.0.0", Folder: filepath.Join(librariesFolder, "TemplateOnly"), Archs: []string{"avr"}},
+	}
+	index := indexOutput{Libraries: []indexLibrary{{LibraryName: "SD", Version: "1.2.2"}, {LibraryName: "TemplateOnly", Version: "1.0.0"}}}
+	previousRun := indexLibrariesAnalyzed{Exists: make(map[string]bool), Failed: map[string]bool{failedCacheKey("SD", "1.2.2"): true}}
+	a := &analysis{
+		ctx:            &types.Context{OtherLibrariesFolders: []string{librariesFolder}},
+		indexJson:      &index,
+		previousRun:    &previousRun,
+		sketchTemplate: DEFAULT_SKETCH_TEMPLATE,
+		matched:        make([]bool, len(index.Libraries)),
+		since:          time.Now().Add(time.Hour),
+	}
+
+	require.NoError(t, a.analyzeLibraries(libraries, 1))
+	require.Equal(t, 1, a.analyzed)
+	require.Equal(t, []skippedLibrary{{Name: "TemplateOnly", Version: "1.0.0", Reason: "unchanged"}}, a.stats.Skipped)
+	require.False(t, previousRun.Failed[failedCacheKey("SD", "1.2.2")])
+}
+
+func TestErrorReportKeepsCompilerOutput(t *testing.T) {
+	defer func(original func(*types.Context) error) { runBuilder = original }(runBuilder)
+	runBuilder = func(ctx *types.Context) error {
+		fmt.Fprintln(ctx.GetLogger().(i18n.OutputCollector).Output(), "Servo.h: No such file or directory")
+		return errors.New("exit status 1")
+	}
+
+	reportDir, err := ioutil.TempDir("", "report")
+	require.NoError(t, err)
+	defer os.RemoveAll(reportDir)
+	reportPath := filepath.Join(reportDir, "errors.jsonl")
+	report, err := newErrorReport(reportPath)
+	require.NoError(t, err)
+
+	librariesFolder := filepath.Join("testdata", "libraries")
+	library := &types.Library{Name: "TemplateOnly", RealName: "TemplateOnly", Version: "1.0.0", Folder: filepath.Join(librariesFolder, "TemplateOnly"), Archs: []string{"avr"}}
+	index := indexOutput{Libraries: []indexLibrary{{LibraryName: "TemplateOnly", Version: "1.0.0"}}}
+	previousRun := indexLibrariesAnalyzed{Exists: make(map[string]bool), Failed: make(map[string]bool)}
+	a := &analysis{
+		ctx:            &types.Context{OtherLibrariesFolders: []string{librariesFolder}},
+		indexJson:      &index,
+		previousRun:    &previousRun,
+		sketchTemplate: DEFAULT_SKETCH_TEMPLATE,
+		matched:        make([]bool, len(index.Libraries)),
+		errors:         report,
+	}
+
+	require.NoError(t, a.analyzeLibraries([]*types.Library{library}, 1))
+	require.NoError(t, report.Close())
+
+	content, err := ioutil.ReadFile(reportPath)
+	require.NoError(t, err)
+	var entry errorReportEntry
+	require.NoError(t, json.NewDecoder(bytes.NewReader(content)).Decode(&entry))
+	require.Equal(t, "sketch failed to compile", entry.Reason)
+	require.Equal(t, "exit status 1", entry.Error)
+	require.Equal(t, "Servo.h: No such file or directory\n", entry.Output)
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"strings"
+
+	"arduino.cc/builder/constants"
+)
+
+// splitList splits a comma separated flag value, dropping empty items
+func splitList(value string) []string {
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// filterArchs drops the excluded architectures from the ones declared by a
+// library. The '*' wildcard is never excluded.
+func filterArchs(archs []string, excluded []string) []string {
+	var filtered []string
+	for _, arch := range archs {
+		if arch == constants.LIBRARY_ALL_ARCHS || !sliceContainsFold(excluded, arch) {
+			filtered = append(filtered, arch)
+		}
+	}
+	return filtered
+}
+
+// allowArchs keeps only the architectures of a library that are in the
+// allow list, plus the '*' wildcard which matches everything. An empty allow
+// list allows everything.
+func allowArchs(archs []string, allowed []string) []string {
+	if len(allowed) == 0 {
+		return archs
+	}
+	var filtered []string
+	for _, arch := range archs {
+		if arch == constants.LIBRARY_ALL_ARCHS || sliceContainsFold(allowed, arch) {
+			filtered = append(filtered, arch)
+		}
+	}
+	return filtered
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFilterArchs(t *testing.T) {
+	excluded := splitList("esp8266, esp32,")
+	require.Equal(t, []string{"esp8266", "esp32"}, excluded)
+
+	require.Empty(t, filterArchs([]string{"esp8266", "esp32"}, excluded))
+	require.Equal(t, []string{"avr"}, filterArchs([]string{"avr", "esp8266"}, excluded))
+	require.Equal(t, []string{"*"}, filterArchs([]string{"*"}, excluded))
+}
+
+func TestAllowArchs(t *testing.T) {
+	allowed := splitList("avr")
+
+	require.Equal(t, []string{"avr"}, allowArchs([]string{"avr", "sam"}, allowed))
+	require.Equal(t, []string{"*"}, allowArchs([]string{"*"}, allowed))
+	require.Empty(t, allowArchs([]string{"esp8266"}, allowed))
+	require.Equal(t, []string{"esp8266"}, allowArchs([]string{"esp8266"}, nil))
+}
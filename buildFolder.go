@@ -0,0 +1,81 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"arduino.cc/builder/constants"
+	"arduino.cc/builder/types"
+	"arduino.cc/builder/utils"
+)
+
+// cleanBuildLibraries removes the libraries compiled in the build folder, so
+// that nothing left by a library can shadow the real libraries while
+// analyzing the next ones
+func cleanBuildLibraries(buildPath string) error {
+	if buildPath == "" {
+		return nil
+	}
+	return os.RemoveAll(filepath.Join(buildPath, constants.FOLDER_LIBRARIES))
+}
+
+// resetBuildFolders empties the build folder and the core cache, so the
+// builder starts over as in a new run
+func resetBuildFolders(ctx *types.Context) error {
+	for _, folder := range []string{ctx.BuildPath, ctx.BuildCachePath} {
+		if folder == "" {
+			continue
+		}
+		if err := os.RemoveAll(folder); err != nil {
+			return err
+		}
+		if err := utils.EnsureFolderExists(folder); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Modification time of every entry of some libraries folders, symlinks
+// excluded: they are created and removed by the analysis itself
+type foldersSnapshot map[string]time.Time
+
+func snapshotFolders(folders []string) foldersSnapshot {
+	snapshot := make(foldersSnapshot)
+	for _, folder := range folders {
+		entries, err := ioutil.ReadDir(folder)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			if entry.Mode()&os.ModeSymlink != 0 {
+				continue
+			}
+			snapshot[filepath.Join(folder, entry.Name())] = entry.ModTime()
+		}
+	}
+	return snapshot
+}
+
+// changes lists, sorted, the entries added, removed or modified since the
+// snapshot was taken
+func (before foldersSnapshot) changes(after foldersSnapshot) []string {
+	var changes []string
+	for path, modTime := range after {
+		if previous, ok := before[path]; !ok {
+			changes = append(changes, "added "+path)
+		} else if !previous.Equal(modTime) {
+			changes = append(changes, "modified "+path)
+		}
+	}
+	for path := range before {
+		if _, ok := after[path]; !ok {
+			changes = append(changes, "removed "+path)
+		}
+	}
+	sort.Strings(changes)
+	return changes
+}
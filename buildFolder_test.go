@@ -0,0 +1,75 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"arduino.cc/builder/types"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCleanBuildLibraries(t *testing.T) {
+	buildPath, err := ioutil.TempDir("", "build")
+	require.NoError(t, err)
+	defer os.RemoveAll(buildPath)
+
+	require.NoError(t, os.MkdirAll(filepath.Join(buildPath, "libraries", "SD"), 0755))
+	require.NoError(t, os.MkdirAll(filepath.Join(buildPath, "core"), 0755))
+
+	require.NoError(t, cleanBuildLibraries(buildPath))
+	_, err = os.Stat(filepath.Join(buildPath, "libraries"))
+	require.True(t, os.IsNotExist(err))
+	_, err = os.Stat(filepath.Join(buildPath, "core"))
+	require.NoError(t, err)
+
+	require.NoError(t, cleanBuildLibraries(""))
+}
+
+func TestFoldersSnapshotChanges(t *testing.T) {
+	librariesFolder, err := ioutil.TempDir("", "libraries")
+	require.NoError(t, err)
+	defer os.RemoveAll(librariesFolder)
+
+	for _, name := range []string{"SD", "Servo"} {
+		require.NoError(t, os.Mkdir(filepath.Join(librariesFolder, name), 0755))
+	}
+	before := snapshotFolders([]string{librariesFolder})
+
+	// our own symlinks are not changes
+	require.NoError(t, os.Symlink(filepath.Join(librariesFolder, "SD"), filepath.Join(librariesFolder, "SD_link")))
+	require.Empty(t, before.changes(snapshotFolders([]string{librariesFolder})))
+
+	require.NoError(t, os.Mkdir(filepath.Join(librariesFolder, "Leftover"), 0755))
+	require.NoError(t, os.Remove(filepath.Join(librariesFolder, "Servo")))
+	later := time.Now().Add(time.Hour)
+	require.NoError(t, os.Chtimes(filepath.Join(librariesFolder, "SD"), later, later))
+
+	require.Equal(t, []string{
+		"added " + filepath.Join(librariesFolder, "Leftover"),
+		"modified " + filepath.Join(librariesFolder, "SD"),
+		"removed " + filepath.Join(librariesFolder, "Servo"),
+	}, before.changes(snapshotFolders([]string{librariesFolder})))
+}
+
+func TestResetBuildFolders(t *testing.T) {
+	buildPath, err := ioutil.TempDir("", "build")
+	require.NoError(t, err)
+	defer os.RemoveAll(buildPath)
+	coreCache, err := ioutil.TempDir("", "core_cache")
+	require.NoError(t, err)
+	defer os.RemoveAll(coreCache)
+
+	require.NoError(t, os.MkdirAll(filepath.Join(buildPath, "job0", "libraries"), 0755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(coreCache, "core_arduino_avr_uno.a"), []byte{}, 0666))
+
+	require.NoError(t, resetBuildFolders(&types.Context{BuildPath: buildPath, BuildCachePath: coreCache}))
+	for _, folder := range []string{buildPath, coreCache} {
+		entries, err := ioutil.ReadDir(folder)
+		require.NoError(t, err)
+		require.Empty(t, entries)
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"arduino.cc/builder/types"
+)
+
+// wait before the first retry of a build, doubled at every retry
+const BUILD_RETRY_BACKOFF = 500 * time.Millisecond
+
+// Messages of failures caused by the environment rather than by the code
+// being compiled: files locked or vanished under our feet, exhausted
+// resources
+var transientBuildErrors = []string{
+	"text file busy",
+	"resource temporarily unavailable",
+	"device or resource busy",
+	"too many open files",
+	"being used by another process",
+	"access is denied",
+	"no such file or directory",
+}
+
+// isTransientBuildError tells if a build failure is worth retrying. Compiler
+// and linker diagnostics never are, whatever they say.
+func isTransientBuildError(err error) bool {
+	if _, ok := err.(*builderPanic); ok {
+		return false
+	}
+	message := strings.ToLower(err.Error())
+	if strings.Contains(message, "error:") || strings.Contains(message, "undefined reference") {
+		return false
+	}
+	for _, transient := range transientBuildErrors {
+		if strings.Contains(message, transient) {
+			return true
+		}
+	}
+	return false
+}
+
+// buildWithRetries runs build, running it again up to retries times, after a
+// growing pause, as long as it fails in a transient way
+func buildWithRetries(ctx *types.Context, build func(*types.Context) error, retries int, backoff time.Duration) error {
+	err := build(ctx)
+	for retry := 1; retry <= retries && err != nil && isTransientBuildError(err); retry++ {
+		if ctx.Verbose {
+			fmt.Println("Build failed with a transient error, retry " + fmt.Sprint(retry) + " of " + fmt.Sprint(retries) + " in " + backoff.String() + ": " + err.Error())
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+		err = build(ctx)
+	}
+	return err
+}
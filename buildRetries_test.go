@@ -0,0 +1,41 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"arduino.cc/builder/types"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsTransientBuildError(t *testing.T) {
+	require.True(t, isTransientBuildError(errors.New("open /tmp/build/core.a: text file busy")))
+	require.True(t, isTransientBuildError(errors.New("The process cannot access the file because it is being used by another process")))
+	require.False(t, isTransientBuildError(errors.New("sketch.ino:1:17: fatal error: Foo.h: No such file or directory")))
+	require.False(t, isTransientBuildError(errors.New("exit status 1")))
+}
+
+func TestBuildWithRetries(t *testing.T) {
+	failures := []error{errors.New("open core.a: text file busy"), errors.New("open core.a: text file busy")}
+	builds := 0
+	build := func(ctx *types.Context) error {
+		builds++
+		if builds <= len(failures) {
+			return failures[builds-1]
+		}
+		return nil
+	}
+
+	require.Error(t, buildWithRetries(&types.Context{}, build, 1, 0))
+	require.Equal(t, 2, builds)
+
+	builds = 0
+	require.NoError(t, buildWithRetries(&types.Context{}, build, 3, 0))
+	require.Equal(t, 3, builds)
+
+	builds = 0
+	failures = []error{errors.New("sketch.ino:3:1: error: 'foo' was not declared in this scope")}
+	require.Error(t, buildWithRetries(&types.Context{}, build, 3, 0))
+	require.Equal(t, 1, builds)
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"arduino.cc/builder/utils"
+)
+
+const CHECKSUM_SHA256 = "SHA-256"
+const CHECKSUM_SHA512 = "SHA-512"
+
+// Prefix of the checksums computed over a library folder, as in
+// FOLDER-SHA-256:<digest>: they can't be mistaken for the checksum of an
+// archive, which starts with the name of the algorithm
+const FOLDER_CHECKSUM_PREFIX = "FOLDER-"
+
+func newChecksumHash(algo string) (hash.Hash, error) {
+	switch algo {
+	case CHECKSUM_SHA256:
+		return sha256.New(), nil
+	case CHECKSUM_SHA512:
+		return sha512.New(), nil
+	}
+	return nil, errors.New("unsupported checksum algorithm '" + algo + "'")
+}
+
+// parseChecksum splits a checksum like SHA-512:<digest> in its algorithm and
+// digest. Folder checksums are recognized too.
+func parseChecksum(checksum string) (algo string, digest string, folder bool, err error) {
+	if strings.HasPrefix(checksum, FOLDER_CHECKSUM_PREFIX) {
+		checksum = strings.TrimPrefix(checksum, FOLDER_CHECKSUM_PREFIX)
+		folder = true
+	}
+	parts := strings.SplitN(checksum, ":", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return "", "", false, errors.New("malformed checksum '" + checksum + "'")
+	}
+	if _, err := newChecksumHash(parts[0]); err != nil {
+		return "", "", false, err
+	}
+	return parts[0], strings.ToLower(parts[1]), folder, nil
+}
+
+// fileChecksum hashes the file at path, like the checksum of an archive in
+// the index
+func fileChecksum(path string, algo string) (string, error) {
+	hash, err := newChecksumHash(algo)
+	if err != nil {
+		return "", err
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return algo + ":" + hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// verifyFileChecksum tells if the file at path matches checksum, using the
+// algorithm named by its prefix, and returns the actual checksum of the file
+func verifyFileChecksum(path string, checksum string) (string, bool, error) {
+	algo, digest, folder, err := parseChecksum(checksum)
+	if err != nil {
+		return "", false, err
+	}
+	if folder {
+		return "", false, errors.New("'" + checksum + "' is the checksum of a folder, not of a file")
+	}
+	actual, err := fileChecksum(path, algo)
+	if err != nil {
+		return "", false, err
+	}
+	return actual, actual == algo+":"+digest, nil
+}
+
+// folderChecksum hashes the relative path and the contents of every file in
+// folder, in lexical order, skipping hidden and source control files. The
+// result only depends on what's in the folder, not on where it lives.
+func folderChecksum(folder string, algo string) (string, error) {
+	hash, err := newChecksumHash(algo)
+	if err != nil {
+		return "", err
+	}
+	err = filepath.Walk(folder, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if path != folder && utils.IsSCCSOrHiddenFile(info) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(folder, path)
+		if err != nil {
+			return err
+		}
+		io.WriteString(hash, filepath.ToSlash(rel))
+		hash.Write([]byte{0})
+
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		_, err = io.Copy(hash, file)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	return FOLDER_CHECKSUM_PREFIX + algo + ":" + hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFolderChecksum(t *testing.T) {
+	folder, err := ioutil.TempDir("", "checksum")
+	require.NoError(t, err)
+	defer os.RemoveAll(folder)
+
+	require.NoError(t, os.MkdirAll(filepath.Join(folder, "src"), os.FileMode(0755)))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(folder, "src", "Lib.h"), []byte("#define LIB"), os.FileMode(0644)))
+
+	checksum, err := folderChecksum(folder, CHECKSUM_SHA256)
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(checksum, FOLDER_CHECKSUM_PREFIX+CHECKSUM_SHA256+":"))
+
+	// source control files don't count
+	require.NoError(t, os.MkdirAll(filepath.Join(folder, ".git"), os.FileMode(0755)))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(folder, ".git", "HEAD"), []byte("ref"), os.FileMode(0644)))
+	same, err := folderChecksum(folder, CHECKSUM_SHA256)
+	require.NoError(t, err)
+	require.Equal(t, checksum, same)
+
+	require.NoError(t, ioutil.WriteFile(filepath.Join(folder, "src", "Lib.h"), []byte("#define LIB 1"), os.FileMode(0644)))
+	changed, err := folderChecksum(folder, CHECKSUM_SHA256)
+	require.NoError(t, err)
+	require.NotEqual(t, checksum, changed)
+}
+
+func TestChecksumAlgorithms(t *testing.T) {
+	file, err := ioutil.TempFile("", "archive")
+	require.NoError(t, err)
+	defer os.Remove(file.Name())
+	_, err = file.WriteString("abc")
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+
+	sha256sum, err := fileChecksum(file.Name(), CHECKSUM_SHA256)
+	require.NoError(t, err)
+	require.Equal(t, "SHA-256:ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad", sha256sum)
+	sha512sum, err := fileChecksum(file.Name(), CHECKSUM_SHA512)
+	require.NoError(t, err)
+	require.Equal(t, "SHA-512:ddaf35a193617abacc417349ae20413112e6fa4e89a97ea20a9eeee64b55d39a2192992a274fc1a836ba3c23a3feebbd454d4423643ce80e2a9ac94fa54ca49f", sha512sum)
+
+	for _, checksum := range []string{sha256sum, sha512sum, strings.ToUpper(sha512sum)} {
+		_, ok, err := verifyFileChecksum(file.Name(), checksum)
+		require.NoError(t, err)
+		require.True(t, ok, checksum)
+	}
+	actual, ok, err := verifyFileChecksum(file.Name(), "SHA-256:0000")
+	require.NoError(t, err)
+	require.False(t, ok)
+	require.Equal(t, sha256sum, actual)
+
+	_, _, err = verifyFileChecksum(file.Name(), "MD5:900150983cd24fb0d6963f7d28e17f72")
+	require.Error(t, err)
+	_, _, folder, err := parseChecksum("FOLDER-SHA-512:abcd")
+	require.NoError(t, err)
+	require.True(t, folder)
+}
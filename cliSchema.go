@@ -0,0 +1,137 @@
+package main
+
+const SCHEMA_DEFAULT = "default"
+const SCHEMA_ARDUINO_CLI = "arduino-cli"
+
+// Library index in the shape consumed by arduino-cli, where everything
+// describing the archive lives in a 'resources' object
+type cliIndexOutput struct {
+	Libraries []cliIndexLibrary `json:"libraries"`
+}
+
+type cliIndexLibrary struct {
+	LibraryName   string       `json:"name"`
+	Version       string       `json:"version"`
+	Author        string       `json:"author"`
+	Maintainer    string       `json:"maintainer"`
+	License       string       `json:"license,omitempty"`
+	Sentence      string       `json:"sentence"`
+	Paragraph     string       `json:"paragraph,omitempty"`
+	Website       string       `json:"website,omitempty"`
+	Category      string       `json:"category,omitempty"`
+	Architectures []string     `json:"architectures,omitempty"`
+	Types         []string     `json:"types,omitempty"`
+	Requires      []string     `json:"requires,omitempty"`
+	CouldRequire  []string     `json:"couldRequire,omitempty"`
+	Resources     cliResources `json:"resources"`
+	SupportLevel  string       `json:"supportLevel,omitempty"`
+
+	IncludeReasons map[string][]string `json:"includeReasons,omitempty"`
+	Evidence       map[string]string   `json:"evidence,omitempty"`
+	AnalyzedWith   string              `json:"analyzedWith,omitempty"`
+	DirectRequires []string            `json:"directRequires,omitempty"`
+}
+
+type cliResources struct {
+	URL             string `json:"url"`
+	ArchiveFileName string `json:"archiveFileName"`
+	Size            int64  `json:"size"`
+	Checksum        string `json:"checksum"`
+}
+
+func toCLIIndex(index *indexOutput) *cliIndexOutput {
+	cliIndex := &cliIndexOutput{Libraries: []cliIndexLibrary{}}
+	for _, lib := range index.Libraries {
+		cliIndex.Libraries = append(cliIndex.Libraries, cliIndexLibrary{
+			LibraryName:   lib.LibraryName,
+			Version:       lib.Version,
+			Author:        lib.Author,
+			Maintainer:    lib.Maintainer,
+			License:       lib.License,
+			Sentence:      lib.Sentence,
+			Paragraph:     lib.Paragraph,
+			Website:       lib.Website,
+			Category:      lib.Category,
+			Architectures: lib.Architectures,
+			Types:         lib.Types,
+			Requires:      lib.Requires,
+			CouldRequire:  lib.CouldRequire,
+			Resources: cliResources{
+				URL:             lib.URL,
+				ArchiveFileName: lib.ArchiveFileName,
+				Size:            lib.Size,
+				Checksum:        lib.Checksum,
+			},
+			SupportLevel:   lib.SupportLevel,
+			IncludeReasons: lib.IncludeReasons,
+			Evidence:       lib.Evidence,
+			AnalyzedWith:   lib.AnalyzedWith,
+			DirectRequires: lib.DirectRequires,
+		})
+	}
+	return cliIndex
+}
+
+func fromCLIIndex(cliIndex *cliIndexOutput) *indexOutput {
+	index := &indexOutput{}
+	for _, lib := range cliIndex.Libraries {
+		index.Libraries = append(index.Libraries, fromCLILibrary(lib))
+	}
+	return index
+}
+
+func fromCLILibrary(lib cliIndexLibrary) indexLibrary {
+	return indexLibrary{
+		LibraryName:     lib.LibraryName,
+		Version:         lib.Version,
+		Author:          lib.Author,
+		Maintainer:      lib.Maintainer,
+		License:         lib.License,
+		Sentence:        lib.Sentence,
+		Paragraph:       lib.Paragraph,
+		Website:         lib.Website,
+		Category:        lib.Category,
+		Architectures:   lib.Architectures,
+		Types:           lib.Types,
+		Requires:        lib.Requires,
+		CouldRequire:    lib.CouldRequire,
+		URL:             lib.Resources.URL,
+		ArchiveFileName: lib.Resources.ArchiveFileName,
+		Size:            lib.Resources.Size,
+		Checksum:        lib.Resources.Checksum,
+		SupportLevel:    lib.SupportLevel,
+		IncludeReasons:  lib.IncludeReasons,
+		Evidence:        lib.Evidence,
+		AnalyzedWith:    lib.AnalyzedWith,
+		DirectRequires:  lib.DirectRequires,
+	}
+}
+
+// indexEntry is an entry of the index in either schema: entries written
+// with -schema arduino-cli keep the archive in a 'resources' object, all the
+// other fields are the same
+type indexEntry struct {
+	indexLibrary
+	Resources *cliResources `json:"resources"`
+}
+
+// library returns the entry as an indexLibrary
+func (entry *indexEntry) library() indexLibrary {
+	library := entry.indexLibrary
+	if entry.Resources != nil {
+		library.URL = entry.Resources.URL
+		library.ArchiveFileName = entry.Resources.ArchiveFileName
+		library.Size = entry.Resources.Size
+		library.Checksum = entry.Resources.Checksum
+	}
+	return library
+}
+
+// indexInSchema returns what gets marshaled as output index for the given
+// -schema
+func indexInSchema(index *indexOutput, schema string) interface{} {
+	if schema == SCHEMA_ARDUINO_CLI {
+		return toCLIIndex(index)
+	}
+	return index
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCLISchemaRoundTrip(t *testing.T) {
+	index := &indexOutput{Libraries: []indexLibrary{{
+		LibraryName:     "Servo",
+		Version:         "1.1.2",
+		Author:          "Michael Margolis, Arduino",
+		Maintainer:      "Arduino <info@arduino.cc>",
+		Sentence:        "Allows Arduino/Genuino boards to control a variety of servo motors.",
+		Category:        "Device Control",
+		Architectures:   []string{"avr", "sam", "samd"},
+		Types:           []string{"Arduino"},
+		Requires:        []string{"Wire", "SPI"},
+		DirectRequires:  []string{"Wire"},
+		Evidence:        map[string]string{"Wire": EVIDENCE_SKETCH},
+		AnalyzedWith:    "arduino:avr 1.6.19",
+		URL:             "http://downloads.arduino.cc/libraries/github.com/arduino-libraries/Servo-1.1.2.zip",
+		ArchiveFileName: "Servo-1.1.2.zip",
+		Size:            14988,
+		Checksum:        "SHA-256:2b5ba25dce5e3a7e7c86b8c6fd5f1e1b5e0f1c4d3a2e8f7c9a1b3c5d7e9f1a2b",
+	}}}
+
+	data, err := json.Marshal(indexInSchema(index, SCHEMA_ARDUINO_CLI))
+	require.NoError(t, err)
+
+	var raw map[string][]map[string]interface{}
+	require.NoError(t, json.Unmarshal(data, &raw))
+	require.NotContains(t, raw["libraries"][0], "url")
+	resources := raw["libraries"][0]["resources"].(map[string]interface{})
+	require.Equal(t, "Servo-1.1.2.zip", resources["archiveFileName"])
+
+	var cliIndex cliIndexOutput
+	require.NoError(t, json.Unmarshal(data, &cliIndex))
+	require.Equal(t, index, fromCLIIndex(&cliIndex))
+}
+
+func TestCLISchemaIsReadBack(t *testing.T) {
+	folder, err := ioutil.TempDir("", "cli_schema")
+	require.NoError(t, err)
+	defer os.RemoveAll(folder)
+	// the cache is written to the working directory
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(folder))
+	defer os.Chdir(wd)
+	defer func(original string) { *outputFlag = original }(*outputFlag)
+	*outputFlag = filepath.Join(folder, "library_index.json")
+	defer func(original string) { *schemaFlag = original }(*schemaFlag)
+	*schemaFlag = SCHEMA_ARDUINO_CLI
+
+	index := &indexOutput{Libraries: []indexLibrary{
+		{LibraryName: "Servo", Version: "1.1.2", Requires: []string{"Wire"}, URL: "http://downloads.arduino.cc/libraries/Servo-1.1.2.zip", ArchiveFileName: "Servo-1.1.2.zip", Size: 14988, Checksum: "SHA-256:2b5b"},
+	}}
+	saveResults(index, &indexLibrariesAnalyzed{Exists: map[string]bool{}})
+
+	loaded, err := loadIndex(*outputFlag, time.Second)
+	require.NoError(t, err)
+	require.Equal(t, *index, loaded)
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Differences between a reference index and the analyzed one, found by
+// -compare-index
+type indexDiff struct {
+	Changed []libraryDiff `json:"changed,omitempty"`
+	// entries of the reference index missing from the analyzed one
+	Missing []indexEntryRef `json:"missing,omitempty"`
+	// entries of the analyzed index missing from the reference one
+	Added []indexEntryRef `json:"added,omitempty"`
+}
+
+type libraryDiff struct {
+	Name            string   `json:"name"`
+	Version         string   `json:"version"`
+	AddedRequires   []string `json:"addedRequires,omitempty"`
+	RemovedRequires []string `json:"removedRequires,omitempty"`
+	// the support level is the only build outcome recorded in the index
+	PreviousSupportLevel string `json:"previousSupportLevel,omitempty"`
+	SupportLevel         string `json:"supportLevel,omitempty"`
+}
+
+// compareIndexes matches the entries of the two indexes by name and version
+// and returns how the analyzed one differs from the reference
+func compareIndexes(reference, analyzed []indexLibrary) indexDiff {
+	var diff indexDiff
+	for _, lib := range reference {
+		idx := indexJsonContains(analyzed, lib.LibraryName, lib.Version)
+		if idx == -1 {
+			diff.Missing = append(diff.Missing, indexEntryRef{Name: lib.LibraryName, Version: lib.Version})
+			continue
+		}
+		current := analyzed[idx]
+		libDiff := libraryDiff{
+			Name:            lib.LibraryName,
+			Version:         lib.Version,
+			AddedRequires:   withoutDependencies(current.Requires, lib.Requires),
+			RemovedRequires: withoutDependencies(lib.Requires, current.Requires),
+		}
+		if lib.SupportLevel != current.SupportLevel {
+			libDiff.PreviousSupportLevel = lib.SupportLevel
+			libDiff.SupportLevel = current.SupportLevel
+		}
+		if len(libDiff.AddedRequires) > 0 || len(libDiff.RemovedRequires) > 0 || lib.SupportLevel != current.SupportLevel {
+			diff.Changed = append(diff.Changed, libDiff)
+		}
+	}
+	for _, lib := range analyzed {
+		if indexJsonContains(reference, lib.LibraryName, lib.Version) == -1 {
+			diff.Added = append(diff.Added, indexEntryRef{Name: lib.LibraryName, Version: lib.Version})
+		}
+	}
+	return diff
+}
+
+func printIndexDiff(diff indexDiff) {
+	for _, lib := range diff.Changed {
+		var changes []string
+		if len(lib.AddedRequires) > 0 {
+			changes = append(changes, "+"+strings.Join(lib.AddedRequires, " +"))
+		}
+		if len(lib.RemovedRequires) > 0 {
+			changes = append(changes, "-"+strings.Join(lib.RemovedRequires, " -"))
+		}
+		if lib.PreviousSupportLevel != lib.SupportLevel {
+			changes = append(changes, "support level "+quoteOrNone(lib.PreviousSupportLevel)+" -> "+quoteOrNone(lib.SupportLevel))
+		}
+		fmt.Println(lib.Name + " " + lib.Version + ": " + strings.Join(changes, ", "))
+	}
+	for _, ref := range diff.Missing {
+		fmt.Println(ref.Name + " " + ref.Version + ": missing")
+	}
+	for _, ref := range diff.Added {
+		fmt.Println(ref.Name + " " + ref.Version + ": new")
+	}
+	fmt.Println(fmt.Sprint(len(diff.Changed)) + " libraries changed, " + fmt.Sprint(len(diff.Missing)) + " missing, " + fmt.Sprint(len(diff.Added)) + " new")
+}
+
+func quoteOrNone(value string) string {
+	if value == "" {
+		return "none"
+	}
+	return value
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompareIndexes(t *testing.T) {
+	reference := []indexLibrary{
+		{LibraryName: "Display", Version: "1.0.0", Requires: []string{"GFX", "Wire"}},
+		{LibraryName: "GFX", Version: "1.0.0", Requires: []string{"SPI"}, SupportLevel: SUPPORT_LEVEL_VERIFIED},
+		{LibraryName: "SD", Version: "1.2.2", Requires: []string{"SPI"}},
+		{LibraryName: "Gone", Version: "0.1.0"},
+	}
+	analyzed := []indexLibrary{
+		{LibraryName: "Display", Version: "1.0.0", Requires: []string{"GFX", "BusIO"}},
+		{LibraryName: "GFX", Version: "1.0.0", Requires: []string{"SPI"}, SupportLevel: SUPPORT_LEVEL_BROKEN},
+		{LibraryName: "SD", Version: "1.2.2", Requires: []string{"SPI"}},
+		{LibraryName: "SD", Version: "1.2.3"},
+	}
+
+	diff := compareIndexes(reference, analyzed)
+	require.Equal(t, []libraryDiff{
+		{Name: "Display", Version: "1.0.0", AddedRequires: []string{"BusIO"}, RemovedRequires: []string{"Wire"}},
+		{Name: "GFX", Version: "1.0.0", PreviousSupportLevel: SUPPORT_LEVEL_VERIFIED, SupportLevel: SUPPORT_LEVEL_BROKEN},
+	}, diff.Changed)
+	require.Equal(t, []indexEntryRef{{Name: "Gone", Version: "0.1.0"}}, diff.Missing)
+	require.Equal(t, []indexEntryRef{{Name: "SD", Version: "1.2.3"}}, diff.Added)
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"arduino.cc/builder/types"
+)
+
+// fqbnsToBuild returns, sorted, the distinct FQBNs the given libraries will
+// be compiled for, along with the safe targets a failing sketch falls back
+// to. Libraries the analysis will skip are left out.
+func (a *analysis) fqbnsToBuild(libraries []*types.Library) []string {
+	seen := make(map[string]bool)
+	var fqbns []string
+	for _, library := range libraries {
+		fqbn, ok := a.willBuild(library)
+		if ok && !seen[fqbn] {
+			seen[fqbn] = true
+			fqbns = append(fqbns, fqbn)
+		}
+	}
+	if len(fqbns) > 0 {
+		for _, fqbn := range safeTargets {
+			if !seen[fqbn] {
+				seen[fqbn] = true
+				fqbns = append(fqbns, fqbn)
+			}
+		}
+	}
+	sort.Strings(fqbns)
+	return fqbns
+}
+
+// precompileCores builds an empty sketch for every FQBN, so the core of each
+// one is compiled exactly once and archived in ctx.BuildCachePath, where the
+// builder looks for it (keyed by FQBN) before compiling the core again.
+func precompileCores(ctx *types.Context, fqbns []string) {
+	tempDir, err := ioutil.TempDir("", "core_precompile")
+	if err != nil {
+		fmt.Println(err.Error())
+		return
+	}
+	defer os.RemoveAll(tempDir)
+
+	ctx.SketchLocation = filepath.Join(tempDir, "core_precompile.ino")
+	ioutil.WriteFile(ctx.SketchLocation, []byte("void setup(){}\nvoid loop(){}\n"), 0666)
+
+	for _, fqbn := range fqbns {
+		ctx.FQBN = fqbn
+		ctx.ImportedLibraries = ctx.ImportedLibraries[:0]
+		ctx.IncludeFolders = ctx.IncludeFolders[:0]
+		if err := runBuilderSafely(ctx); err != nil {
+			fmt.Println("Cannot precompile core for " + fqbn + ": " + err.Error())
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+
+	"arduino.cc/builder/types"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFQBNsToBuild(t *testing.T) {
+	librariesFolder := filepath.Join("testdata", "libraries")
+	sd := &types.Library{Name: "SD", RealName: "SD", Version: "1.2.2", Folder: filepath.Join(librariesFolder, "SD"), Archs: []string{"avr"}}
+	unindexed := &types.Library{Name: "TemplateOnly", RealName: "TemplateOnly", Version: "1.0.0", Folder: filepath.Join(librariesFolder, "TemplateOnly"), Archs: []string{"sam"}}
+	index := indexOutput{Libraries: []indexLibrary{{LibraryName: "SD", Version: "1.2.2"}}}
+	previousRun := indexLibrariesAnalyzed{Exists: make(map[string]bool), Failed: make(map[string]bool)}
+	a := &analysis{indexJson: &index, previousRun: &previousRun}
+
+	sdFQBN, _ := resolveFQBN("SD", []string{"avr"})
+	expected := map[string]bool{sdFQBN: true}
+	for _, fqbn := range safeTargets {
+		expected[fqbn] = true
+	}
+	fqbns := a.fqbnsToBuild([]*types.Library{sd, unindexed})
+	require.Len(t, fqbns, len(expected))
+	for _, fqbn := range fqbns {
+		require.True(t, expected[fqbn], fqbn)
+	}
+	require.IsIncreasing(t, fqbns)
+
+	// a cache hit is not built, nothing to precompile
+	previousRun.Exists[analyzedCacheKey("SD", sdFQBN)] = true
+	require.Empty(t, a.fqbnsToBuild([]*types.Library{sd, unindexed}))
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"encoding/csv"
+	"os"
+)
+
+const DEPENDENCY_KIND_LIBMANAGER = "libmanager"
+const DEPENDENCY_KIND_INTERNAL = "internal"
+const DEPENDENCY_KIND_SUPPORT = "support"
+
+// One row of the -csv-out export
+type dependencyRecord struct {
+	Name       string
+	Version    string
+	Dependency string
+	Kind       string
+}
+
+func dependencyRecords(name, version string, deps, internalDeps []string) []dependencyRecord {
+	var records []dependencyRecord
+	for _, dep := range deps {
+		records = append(records, dependencyRecord{Name: name, Version: version, Dependency: dep, Kind: DEPENDENCY_KIND_LIBMANAGER})
+	}
+	for _, dep := range internalDeps {
+		records = append(records, dependencyRecord{Name: name, Version: version, Dependency: dep, Kind: DEPENDENCY_KIND_INTERNAL})
+	}
+	return records
+}
+
+func writeDependenciesCSV(path string, records []dependencyRecord) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	writer.Write([]string{"name", "version", "dependency", "kind"})
+	for _, record := range records {
+		writer.Write([]string{record.Name, record.Version, record.Dependency, record.Kind})
+	}
+	writer.Flush()
+	return writer.Error()
+}
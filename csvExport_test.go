@@ -0,0 +1,37 @@
+package main
+
+import (
+	"encoding/csv"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteDependenciesCSV(t *testing.T) {
+	dir, err := ioutil.TempDir("", "csv")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	records := []dependencyRecord{
+		{Name: `Adafruit "GFX", Library`, Version: "1.2.3", Dependency: "SPI", Kind: DEPENDENCY_KIND_LIBMANAGER},
+		{Name: "SD", Version: "1.2.2", Dependency: "Wire", Kind: DEPENDENCY_KIND_INTERNAL},
+	}
+	path := filepath.Join(dir, "deps.csv")
+	require.NoError(t, writeDependenciesCSV(path, records))
+
+	file, err := os.Open(path)
+	require.NoError(t, err)
+	defer file.Close()
+	rows, err := csv.NewReader(file).ReadAll()
+	require.NoError(t, err)
+
+	require.Equal(t, []string{"name", "version", "dependency", "kind"}, rows[0])
+	var read []dependencyRecord
+	for _, row := range rows[1:] {
+		read = append(read, dependencyRecord{Name: row[0], Version: row[1], Dependency: row[2], Kind: row[3]})
+	}
+	require.Equal(t, records, read)
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"sort"
+)
+
+// How consistently the compilation units of a library (the generated sketch
+// and its examples) agree on its dependencies, exported with -dep-stability
+type depStability struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	Units   int    `json:"units"`
+	// seen by every unit
+	Intersection []string `json:"intersection"`
+	// seen by at least one unit
+	Union []string `json:"union"`
+}
+
+// computeDepStability compares the dependencies found by every compilation
+// unit of a library
+func computeDepStability(name, version string, units [][]string) depStability {
+	stability := depStability{Name: name, Version: version, Units: len(units), Intersection: []string{}, Union: []string{}}
+	if len(units) == 0 {
+		return stability
+	}
+	stability.Union = mergeDependencies(units...)
+	for _, dep := range stability.Union {
+		seenByAll := true
+		for _, unit := range units {
+			if !sliceContainsFold(unit, dep) {
+				seenByAll = false
+				break
+			}
+		}
+		if seenByAll {
+			stability.Intersection = append(stability.Intersection, dep)
+		}
+	}
+	return stability
+}
+
+func writeDepStability(path string, stability []depStability) error {
+	sorted := append([]depStability{}, stability...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].Name != sorted[j].Name {
+			return sorted[i].Name < sorted[j].Name
+		}
+		return sorted[i].Version < sorted[j].Version
+	})
+	return writeJsonAtomically(path, sorted)
+}
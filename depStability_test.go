@@ -0,0 +1,22 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestComputeDepStability(t *testing.T) {
+	stability := computeDepStability("Display", "1.0.0", [][]string{
+		{"GFX", "SPI"},
+		{"GFX", "SPI", "Wire"},
+		{"gfx", "SD"},
+	})
+	require.Equal(t, 3, stability.Units)
+	require.Equal(t, []string{"GFX"}, stability.Intersection)
+	require.Equal(t, []string{"GFX", "SD", "SPI", "Wire"}, stability.Union)
+
+	empty := computeDepStability("Alone", "1.0.0", nil)
+	require.Equal(t, 0, empty.Units)
+	require.Empty(t, empty.Union)
+}
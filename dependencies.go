@@ -0,0 +1,242 @@
+package main
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"arduino.cc/builder/types"
+	textdistance "github.com/masatana/go-textdistance"
+)
+
+// appendDependencies sorts the libraries imported by the last build into the
+// ones provided by the library manager (living in libManagerFolder) and the
+// ones provided by cores or builtin folders, skipping the library itself.
+// Names are compared case insensitively and, when the index knows about a
+// dependency, its casing from the index is used.
+func appendDependencies(imported []*types.Library, library *types.Library, libManagerFolder string, index []indexLibrary, deps, internalDeps []string) ([]string, []string) {
+	for _, dep := range imported {
+		if strings.EqualFold(dep.RealName, library.RealName) || sliceContainsFold(deps, dep.RealName) || sliceContainsFold(internalDeps, dep.RealName) {
+			continue
+		}
+		if isInFolder(dep.Folder, libManagerFolder) {
+			deps = append(deps, canonicalName(index, dep.RealName))
+		} else {
+			internalDeps = append(internalDeps, dep.RealName)
+		}
+	}
+	return deps, internalDeps
+}
+
+// librarySourcesByPriority lists the folders libraries are taken from, the
+// highest priority first: the -libraries folders in the given order (the
+// first being the one of the library manager), then the libraries folders of
+// the platforms as found by the last build, then the -built-in-libraries
+// folders in the given order. This mirrors the builder, where user libraries
+// override the platform ones, which override the built-in ones.
+func librarySourcesByPriority(ctx *types.Context) []string {
+	var sources []string
+	sources = append(sources, ctx.OtherLibrariesFolders...)
+	var platformFolders []string
+	for _, folder := range ctx.LibrariesFolders {
+		if !isListedFolder(folder, ctx.OtherLibrariesFolders) && !isListedFolder(folder, ctx.BuiltInLibrariesFolders) {
+			platformFolders = append([]string{folder}, platformFolders...)
+		}
+	}
+	sources = append(sources, platformFolders...)
+	sources = append(sources, ctx.BuiltInLibrariesFolders...)
+	return sources
+}
+
+func isListedFolder(folder string, folders []string) bool {
+	for _, listed := range folders {
+		if isInFolder(folder, listed) && isInFolder(listed, folder) {
+			return true
+		}
+	}
+	return false
+}
+
+// sourcePriority is the position in sources of the folder library lives in,
+// or len(sources) if it's in none of them
+func sourcePriority(library *types.Library, sources []string) int {
+	for priority, source := range sources {
+		if isInFolder(library.Folder, source) {
+			return priority
+		}
+	}
+	return len(sources)
+}
+
+// resolveByPriority replaces every imported library with the library with
+// the same name living in the highest priority source, so that a dependency
+// available from several folders is always recorded against the same one,
+// whichever copy the build happened to use.
+func resolveByPriority(imported []*types.Library, available []*types.Library, sources []string) []*types.Library {
+	var resolved []*types.Library
+	for _, dep := range imported {
+		best := dep
+		bestPriority := sourcePriority(dep, sources)
+		for _, candidate := range available {
+			if !strings.EqualFold(candidate.RealName, dep.RealName) {
+				continue
+			}
+			if priority := sourcePriority(candidate, sources); priority < bestPriority {
+				best = candidate
+				bestPriority = priority
+			}
+		}
+		resolved = append(resolved, best)
+	}
+	return resolved
+}
+
+// splitSupportLibraries puts apart the libraries living in one of the
+// support folders, returning their names
+func splitSupportLibraries(imported []*types.Library, supportFolders []string) ([]*types.Library, []string) {
+	var kept []*types.Library
+	var support []string
+	for _, dep := range imported {
+		if sourcePriority(dep, supportFolders) < len(supportFolders) {
+			support = append(support, dep.RealName)
+		} else {
+			kept = append(kept, dep)
+		}
+	}
+	return kept, support
+}
+
+// canonicalName returns the name used by the index for a library, falling
+// back to name itself when no entry matches.
+func canonicalName(index []indexLibrary, name string) string {
+	for _, lib := range index {
+		if strings.EqualFold(lib.LibraryName, name) {
+			return lib.LibraryName
+		}
+	}
+	return name
+}
+
+// Similarity a dependency name must exceed to be resolved to an index entry
+// with a different name by -flatten-requires
+const ALIAS_MATCH_THRESHOLD = 0.95
+
+// flattenedName returns the name of the index entry name refers to: the one
+// named the same, case insensitively, else the most similar one (by
+// Jaro-Winkler similarity, ignoring case) above ALIAS_MATCH_THRESHOLD. The
+// boolean is false, and name is returned, if no entry is close enough.
+func flattenedName(index []indexLibrary, name string) (string, bool) {
+	best := ""
+	bestScore := ALIAS_MATCH_THRESHOLD
+	lowerName := strings.ToLower(name)
+	for _, lib := range index {
+		if strings.EqualFold(lib.LibraryName, name) {
+			return lib.LibraryName, true
+		}
+		if score := textdistance.JaroWinklerDistance(strings.ToLower(lib.LibraryName), lowerName); score > bestScore {
+			best = lib.LibraryName
+			bestScore = score
+		}
+	}
+	if best == "" {
+		return name, false
+	}
+	return best, true
+}
+
+// isInFolder tells if path is folder or lives somewhere below it. Relative
+// paths are taken from the working directory, like the builder does.
+func isInFolder(path, folder string) bool {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+	folder, err = filepath.Abs(folder)
+	if err != nil {
+		return false
+	}
+	rel, err := filepath.Rel(folder, path)
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// notInIndex returns the dependencies no entry of the index is named after:
+// the Library Manager can't install them
+func notInIndex(index []indexLibrary, deps []string) []string {
+	var missing []string
+	for _, dep := range deps {
+		found := false
+		for _, lib := range index {
+			if strings.EqualFold(lib.LibraryName, dep) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			missing = append(missing, dep)
+		}
+	}
+	return missing
+}
+
+// withoutDependencies returns deps without the dropped ones
+func withoutDependencies(deps []string, dropped []string) []string {
+	var kept []string
+	for _, dep := range deps {
+		if !sliceContainsFold(dropped, dep) {
+			kept = append(kept, dep)
+		}
+	}
+	return kept
+}
+
+func sliceContainsFold(slice []string, target string) bool {
+	for _, elem := range slice {
+		if strings.EqualFold(elem, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// mergeDependencies returns the sorted union of the given lists, without
+// case insensitive duplicates.
+func mergeDependencies(lists ...[]string) []string {
+	var merged []string
+	for _, list := range lists {
+		for _, dep := range list {
+			if !sliceContainsFold(merged, dep) {
+				merged = append(merged, dep)
+			}
+		}
+	}
+	sort.Strings(merged)
+	return merged
+}
+
+func findExamples(library *types.Library) []string {
+	examples, _ := findFilesInFolder(filepath.Join(library.Folder, "examples"), ".ino", true)
+	return examples
+}
+
+// needsExamplesFallback tells if the dependencies of a library must be taken
+// from its examples. Header only libraries (templates, mostly) may pull
+// nothing when their headers are just included, since nothing gets
+// instantiated: if the generated sketch finds no dependency at all but the
+// library has examples, compiling them gives a better answer.
+func needsExamplesFallback(deps, internalDeps, examples []string) bool {
+	return len(deps) == 0 && len(internalDeps) == 0 && len(examples) > 0
+}
+
+// Skip reason of the libraries with nothing to compile
+const NO_SOURCES_STATUS = "uncompilable: no sources"
+
+// hasNoSources tells if the library has neither a header the generated
+// sketch could include nor examples: an empty or documentation only folder,
+// which would otherwise pass as a library without dependencies
+func hasNoSources(library *types.Library) bool {
+	_, match := includeHeadersFromLibraryFolder(library)
+	return match == HEADER_NONE && len(findExamples(library)) == 0
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"arduino.cc/builder/types"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAppendDependenciesIsCaseInsensitive(t *testing.T) {
+	library := &types.Library{RealName: "MyLib", Folder: "/libs/MyLib"}
+	wire1 := &types.Library{RealName: "Wire", Folder: "/libs/Wire"}
+	wire2 := &types.Library{RealName: "wire", Folder: "/libs/wire"}
+	index := []indexLibrary{{LibraryName: "WIRE"}}
+
+	deps, internalDeps := appendDependencies([]*types.Library{wire1, wire2}, library, "/libs", index, nil, nil)
+	require.Equal(t, []string{"WIRE"}, deps)
+	require.Empty(t, internalDeps)
+
+	// Already collected with another casing, from a previous build
+	deps, internalDeps = appendDependencies([]*types.Library{wire2}, library, "/libs", index, deps, internalDeps)
+	require.Equal(t, []string{"WIRE"}, deps)
+	require.Empty(t, internalDeps)
+}
+
+func TestAppendDependenciesSkipsLibraryItself(t *testing.T) {
+	library := &types.Library{RealName: "MyLib", Folder: "/libs/MyLib"}
+	self := &types.Library{RealName: "mylib", Folder: "/libs/MyLib"}
+	spi := &types.Library{RealName: "SPI", Folder: "/hardware/avr/libraries/SPI"}
+
+	deps, internalDeps := appendDependencies([]*types.Library{self, spi}, library, "/libs", nil, nil, nil)
+	require.Empty(t, deps)
+	require.Equal(t, []string{"SPI"}, internalDeps)
+}
+
+func TestMergeDependencies(t *testing.T) {
+	merged := mergeDependencies([]string{"Servo", "Adafruit GFX Library"}, []string{"SPI", "servo", "Wire"})
+	require.Equal(t, []string{"Adafruit GFX Library", "SPI", "Servo", "Wire"}, merged)
+}
+
+func TestNeedsExamplesFallback(t *testing.T) {
+	templateOnly := &types.Library{RealName: "TemplateOnly", Folder: "testdata/libraries/TemplateOnly"}
+	examples := findExamples(templateOnly)
+	require.Equal(t, 1, len(examples))
+	require.True(t, needsExamplesFallback(nil, nil, examples))
+	require.False(t, needsExamplesFallback(nil, []string{"Wire"}, examples))
+
+	noExamples := &types.Library{RealName: "NoExamples", Folder: "testdata/libraries/NoExamples"}
+	examples = findExamples(noExamples)
+	require.Empty(t, examples)
+	require.False(t, needsExamplesFallback(nil, nil, examples))
+}
+
+func TestNotInIndex(t *testing.T) {
+	index := []indexLibrary{{LibraryName: "Adafruit GFX Library"}, {LibraryName: "Servo"}}
+	deps := []string{"Servo", "adafruit gfx library", "PrivateLib"}
+
+	missing := notInIndex(index, deps)
+	require.Equal(t, []string{"PrivateLib"}, missing)
+	require.Equal(t, []string{"Servo", "adafruit gfx library"}, withoutDependencies(deps, missing))
+}
+
+func TestResolveByPriority(t *testing.T) {
+	ctx := &types.Context{
+		OtherLibrariesFolders:   []string{"/sketchbook/libraries"},
+		BuiltInLibrariesFolders: []string{"/ide/libraries"},
+		LibrariesFolders:        []string{"/ide/libraries", "/hardware/arduino/avr/libraries", "/sketchbook/libraries"},
+	}
+	sources := librarySourcesByPriority(ctx)
+	require.Equal(t, []string{"/sketchbook/libraries", "/hardware/arduino/avr/libraries", "/ide/libraries"}, sources)
+
+	library := &types.Library{RealName: "MyLib", Folder: "/sketchbook/libraries/MyLib"}
+	builtinServo := &types.Library{RealName: "Servo", Folder: "/ide/libraries/Servo"}
+	libManagerServo := &types.Library{RealName: "Servo", Folder: "/sketchbook/libraries/Servo"}
+	builtinEthernet := &types.Library{RealName: "Ethernet", Folder: "/ide/libraries/Ethernet"}
+	available := []*types.Library{builtinServo, builtinEthernet, libManagerServo}
+
+	// the build picked the built-in Servo, but the library manager one wins
+	imported := resolveByPriority([]*types.Library{builtinServo, builtinEthernet}, available, sources)
+	require.Equal(t, []*types.Library{libManagerServo, builtinEthernet}, imported)
+
+	deps, internalDeps := appendDependencies(imported, library, ctx.OtherLibrariesFolders[0], nil, nil, nil)
+	require.Equal(t, []string{"Servo"}, deps)
+	require.Equal(t, []string{"Ethernet"}, internalDeps)
+}
+
+func TestSplitSupportLibraries(t *testing.T) {
+	imported := []*types.Library{
+		{RealName: "GFX", Folder: "/home/me/libraries/GFX"},
+		{RealName: "Helper", Folder: "/home/me/support/Helper"},
+		{RealName: "SPI", Folder: "/opt/hardware/avr/libraries/SPI"},
+	}
+
+	kept, support := splitSupportLibraries(imported, []string{"/home/me/support"})
+	require.Equal(t, []*types.Library{imported[0], imported[2]}, kept)
+	require.Equal(t, []string{"Helper"}, support)
+
+	kept, support = splitSupportLibraries(imported, nil)
+	require.Equal(t, imported, kept)
+	require.Empty(t, support)
+}
+
+func TestHasNoSources(t *testing.T) {
+	folder, err := ioutil.TempDir("", "docs_only")
+	require.NoError(t, err)
+	defer os.RemoveAll(folder)
+	require.NoError(t, ioutil.WriteFile(filepath.Join(folder, "README.md"), []byte("# Docs\n"), 0666))
+	library := &types.Library{Name: "DocsOnly", Folder: folder, SrcFolder: filepath.Join(folder, "src")}
+	require.True(t, hasNoSources(library))
+
+	require.NoError(t, os.MkdirAll(filepath.Join(folder, "examples", "Basic"), 0755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(folder, "examples", "Basic", "Basic.ino"), []byte("void setup(){}\nvoid loop(){}\n"), 0666))
+	require.False(t, hasNoSources(library))
+
+	sd := filepath.Join("testdata", "libraries", "SD")
+	require.False(t, hasNoSources(&types.Library{Name: "SD", Folder: sd, SrcFolder: filepath.Join(sd, "src")}))
+}
+
+func TestFlattenedName(t *testing.T) {
+	index := []indexLibrary{{LibraryName: "Adafruit GFX Library"}, {LibraryName: "Adafruit BusIO"}, {LibraryName: "SD"}}
+
+	name, ok := flattenedName(index, "sd")
+	require.True(t, ok)
+	require.Equal(t, "SD", name)
+
+	name, ok = flattenedName(index, "Adafruit_GFX_Library")
+	require.True(t, ok)
+	require.Equal(t, "Adafruit GFX Library", name)
+
+	name, ok = flattenedName(index, "Servo")
+	require.False(t, ok)
+	require.Equal(t, "Servo", name)
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"strings"
+)
+
+// Formats of the 'requires' written in the index, chosen with
+// -dependency-format
+const DEPENDENCY_FORMAT_NAME = "name"
+const DEPENDENCY_FORMAT_CONSTRAINED = "constrained"
+
+// constrainedIndex returns a copy of the index where every dependency in
+// 'requires' whose version the analysis compiled against is known is
+// written as in the 'depends' property of library.properties, "Name
+// (>=version)". The index itself keeps the bare names the analysis works
+// with.
+func constrainedIndex(indexJson *indexOutput) *indexOutput {
+	libraries := append([]indexLibrary{}, indexJson.Libraries...)
+	for idx := range libraries {
+		if len(libraries[idx].Requires) == 0 {
+			continue
+		}
+		var requires []string
+		for _, dep := range libraries[idx].Requires {
+			if version := libraries[idx].RequiresVersions[strings.ToLower(dep)]; version != "" {
+				dep += " (>=" + version + ")"
+			}
+			requires = append(requires, dep)
+		}
+		libraries[idx].Requires = requires
+	}
+	return &indexOutput{Libraries: libraries}
+}
+
+// stripConstraints turns the 'requires' written by a constrained run back
+// into bare names, keeping their versions for the next write
+func stripConstraints(libraries []indexLibrary) {
+	for idx := range libraries {
+		for depIdx, dep := range libraries[idx].Requires {
+			paren := strings.Index(dep, "(")
+			if paren == -1 {
+				continue
+			}
+			name := strings.TrimSpace(dep[:paren])
+			constraint := strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(dep[paren+1:]), ")"))
+			if strings.HasPrefix(constraint, ">=") {
+				if libraries[idx].RequiresVersions == nil {
+					libraries[idx].RequiresVersions = make(map[string]string)
+				}
+				libraries[idx].RequiresVersions[strings.ToLower(name)] = strings.TrimSpace(strings.TrimPrefix(constraint, ">="))
+			}
+			libraries[idx].Requires[depIdx] = name
+		}
+	}
+}
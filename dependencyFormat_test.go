@@ -0,0 +1,23 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestConstrainedIndex(t *testing.T) {
+	index := &indexOutput{Libraries: []indexLibrary{
+		{LibraryName: "Weather Station", Version: "0.3.0", Requires: []string{"ArduinoJson", "Adafruit Unified Sensor"}, RequiresVersions: map[string]string{"arduinojson": "6.9.1"}},
+		{LibraryName: "ArduinoJson", Version: "6.10.0"},
+		{LibraryName: "ArduinoJson", Version: "6.9.1"},
+	}}
+
+	constrained := constrainedIndex(index)
+	require.Equal(t, []string{"ArduinoJson (>=6.9.1)", "Adafruit Unified Sensor"}, constrained.Libraries[0].Requires)
+	require.Equal(t, []string{"ArduinoJson", "Adafruit Unified Sensor"}, index.Libraries[0].Requires)
+
+	constrained.Libraries[0].RequiresVersions = nil
+	stripConstraints(constrained.Libraries)
+	require.Equal(t, index.Libraries[0], constrained.Libraries[0])
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"io/ioutil"
+	"sort"
+	"strings"
+)
+
+// Dependency graph built from the 'requires' of the index entries: every
+// library points to the libraries it requires. Versions of the same library
+// are collapsed in a single node.
+type dependencyGraph map[string][]string
+
+type dependencyEdge struct {
+	From string
+	To   string
+}
+
+func buildDependencyGraph(libraries []indexLibrary) dependencyGraph {
+	graph := make(dependencyGraph)
+	for _, lib := range libraries {
+		if _, ok := graph[lib.LibraryName]; !ok {
+			graph[lib.LibraryName] = []string{}
+		}
+		for _, dep := range lib.Requires {
+			if _, ok := graph[dep]; !ok {
+				graph[dep] = []string{}
+			}
+			if !sliceContainsFold(graph[lib.LibraryName], dep) && dep != lib.LibraryName {
+				graph[lib.LibraryName] = append(graph[lib.LibraryName], dep)
+			}
+		}
+	}
+	return graph
+}
+
+func (graph dependencyGraph) sortedNodes() []string {
+	var nodes []string
+	for node := range graph {
+		nodes = append(nodes, node)
+	}
+	sort.Strings(nodes)
+	return nodes
+}
+
+// installOrder sorts the graph topologically, so that every library comes
+// after the libraries it requires. Ties are broken alphabetically. If the
+// graph contains cycles, each one is broken by dropping a single edge on it,
+// the one leaving its alphabetically first library; the dropped edges are
+// returned.
+func (graph dependencyGraph) installOrder() ([]string, []dependencyEdge) {
+	pending := make(map[string]map[string]bool)
+	for node, deps := range graph {
+		pending[node] = make(map[string]bool)
+		for _, dep := range deps {
+			pending[node][dep] = true
+		}
+	}
+
+	var order []string
+	var dropped []dependencyEdge
+	for len(pending) > 0 {
+		var ready []string
+		for node, deps := range pending {
+			if len(deps) == 0 {
+				ready = append(ready, node)
+			}
+		}
+		sort.Strings(ready)
+
+		if len(ready) == 0 {
+			edge := findCycleEdge(pending)
+			delete(pending[edge.From], edge.To)
+			dropped = append(dropped, edge)
+			continue
+		}
+
+		for _, node := range ready {
+			order = append(order, node)
+			delete(pending, node)
+			for _, deps := range pending {
+				delete(deps, node)
+			}
+		}
+	}
+	return order, dropped
+}
+
+// findCycleEdge returns the edge leaving the alphabetically first library of
+// a cycle among the pending ones. Every pending library still waits for
+// another one, so walking from any of them along their (alphabetically
+// first) dependencies always ends up going round a cycle.
+func findCycleEdge(pending map[string]map[string]bool) dependencyEdge {
+	var waiting []string
+	for node := range pending {
+		waiting = append(waiting, node)
+	}
+	sort.Strings(waiting)
+
+	visited := make(map[string]int)
+	var path []string
+	node := waiting[0]
+	for {
+		if at, ok := visited[node]; ok {
+			path = path[at:]
+			break
+		}
+		visited[node] = len(path)
+		path = append(path, node)
+		var deps []string
+		for dep := range pending[node] {
+			deps = append(deps, dep)
+		}
+		sort.Strings(deps)
+		node = deps[0]
+	}
+
+	first := 0
+	for idx := range path {
+		if path[idx] < path[first] {
+			first = idx
+		}
+	}
+	return dependencyEdge{From: path[first], To: path[(first+1)%len(path)]}
+}
+
+func writeInstallOrder(path string, order []string) error {
+	return ioutil.WriteFile(path, []byte(strings.Join(order, "\n")+"\n"), 0666)
+}
+
+// dependents transposes the graph: every library points to the libraries
+// requiring it, sorted. Libraries nobody requires are left out.
+func (graph dependencyGraph) dependents() map[string][]string {
+	dependents := make(map[string][]string)
+	for _, node := range graph.sortedNodes() {
+		for _, dep := range graph[node] {
+			dependents[dep] = append(dependents[dep], node)
+		}
+	}
+	return dependents
+}
+
+// Node of the -graph-json export
+type graphNode struct {
+	Requires   []string `json:"requires"`
+	RequiredBy []string `json:"requiredBy"`
+}
+
+// adjacency lists, for every library, both the libraries it requires and
+// the ones requiring it
+func (graph dependencyGraph) adjacency() map[string]graphNode {
+	dependents := graph.dependents()
+	adjacency := make(map[string]graphNode)
+	for node, deps := range graph {
+		requiredBy := dependents[node]
+		if requiredBy == nil {
+			requiredBy = []string{}
+		}
+		adjacency[node] = graphNode{Requires: deps, RequiredBy: requiredBy}
+	}
+	return adjacency
+}
+
+// reachable returns the libraries required by node, directly or through a
+// chain of up to depth other libraries, nearest first
+func (graph dependencyGraph) reachable(node string, depth int) []string {
+	var reached []string
+	seen := map[string]bool{node: true}
+	frontier := []string{node}
+	for hop := 0; hop <= depth && len(frontier) > 0; hop++ {
+		var next []string
+		for _, current := range frontier {
+			for _, dep := range graph[current] {
+				if !seen[dep] {
+					seen[dep] = true
+					reached = append(reached, dep)
+					next = append(next, dep)
+				}
+			}
+		}
+		frontier = next
+	}
+	return reached
+}
+
+// expandedIndex returns a copy of the index where the 'requires' of every
+// library also list the libraries required transitively, up to depth levels
+// beyond the direct ones: depth 0 leaves the direct dependencies only. The
+// direct ones keep coming first, and are kept in 'directRequires' too so that
+// reading the index back doesn't take the others as direct. -deny-deps
+// applies to the added ones as well.
+func expandedIndex(indexJson *indexOutput, depth int) *indexOutput {
+	if depth <= 0 {
+		return indexJson
+	}
+	libraries := append([]indexLibrary{}, indexJson.Libraries...)
+	graph := buildDependencyGraph(libraries)
+	for idx := range libraries {
+		if len(libraries[idx].Requires) == 0 {
+			continue
+		}
+		direct := libraries[idx].Requires
+		requires := append([]string{}, direct...)
+		for _, dep := range graph.reachable(libraries[idx].LibraryName, depth) {
+			if !sliceContainsFold(requires, dep) {
+				requires = append(requires, dep)
+			}
+		}
+		requires = denyDependencies(libraries[idx].LibraryName, requires)
+		if len(requires) != len(direct) {
+			libraries[idx].Requires = requires
+			libraries[idx].DirectRequires = direct
+		}
+	}
+	return &indexOutput{Libraries: libraries}
+}
+
+// restoreDirectRequires turns the 'requires' written by a run with
+// -dependency-depth back into the direct dependencies
+func restoreDirectRequires(libraries []indexLibrary) {
+	for idx := range libraries {
+		if libraries[idx].DirectRequires != nil {
+			libraries[idx].Requires = libraries[idx].DirectRequires
+			libraries[idx].DirectRequires = nil
+		}
+	}
+}
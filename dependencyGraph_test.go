@@ -0,0 +1,108 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestInstallOrder(t *testing.T) {
+	libraries := []indexLibrary{
+		{LibraryName: "Display", Requires: []string{"GFX", "BusIO"}},
+		{LibraryName: "GFX", Requires: []string{"BusIO"}},
+		{LibraryName: "BusIO"},
+		{LibraryName: "Alone"},
+	}
+
+	order, dropped := buildDependencyGraph(libraries).installOrder()
+	require.Equal(t, []string{"Alone", "BusIO", "GFX", "Display"}, order)
+	require.Empty(t, dropped)
+}
+
+func TestInstallOrderBreaksCycles(t *testing.T) {
+	libraries := []indexLibrary{
+		{LibraryName: "B", Requires: []string{"A"}},
+		{LibraryName: "A", Requires: []string{"B"}},
+		{LibraryName: "C", Requires: []string{"A"}},
+	}
+
+	order, dropped := buildDependencyGraph(libraries).installOrder()
+	require.Equal(t, []string{"A", "B", "C"}, order)
+	require.Equal(t, []dependencyEdge{{From: "A", To: "B"}}, dropped)
+}
+
+func TestInstallOrderBreaksOnlyCycles(t *testing.T) {
+	libraries := []indexLibrary{
+		{LibraryName: "A", Requires: []string{"C"}},
+		{LibraryName: "C", Requires: []string{"D"}},
+		{LibraryName: "D", Requires: []string{"C"}},
+	}
+
+	order, dropped := buildDependencyGraph(libraries).installOrder()
+	require.Equal(t, []string{"C", "A", "D"}, order)
+	require.Equal(t, []dependencyEdge{{From: "C", To: "D"}}, dropped)
+}
+
+func TestDependents(t *testing.T) {
+	libraries := []indexLibrary{
+		{LibraryName: "Display", Version: "1.0.0", Requires: []string{"GFX", "BusIO"}},
+		{LibraryName: "Display", Version: "1.1.0", Requires: []string{"GFX", "BusIO"}},
+		{LibraryName: "GFX", Requires: []string{"BusIO"}},
+		{LibraryName: "BusIO"},
+	}
+
+	require.Equal(t, map[string][]string{
+		"BusIO": {"Display", "GFX"},
+		"GFX":   {"Display"},
+	}, buildDependencyGraph(libraries).dependents())
+}
+
+func TestExpandedIndex(t *testing.T) {
+	index := &indexOutput{Libraries: []indexLibrary{
+		{LibraryName: "App", Requires: []string{"Display"}},
+		{LibraryName: "Display", Requires: []string{"GFX"}},
+		{LibraryName: "GFX", Requires: []string{"BusIO"}},
+		{LibraryName: "BusIO", Requires: []string{"Wire"}},
+	}}
+
+	require.Equal(t, []string{"Display"}, expandedIndex(index, 0).Libraries[0].Requires)
+
+	expanded := expandedIndex(index, 2)
+	require.Equal(t, []string{"Display", "GFX", "BusIO"}, expanded.Libraries[0].Requires)
+	require.Equal(t, []string{"Display"}, expanded.Libraries[0].DirectRequires)
+	require.Equal(t, []string{"GFX", "BusIO", "Wire"}, expanded.Libraries[1].Requires)
+	require.Equal(t, []string{"Wire"}, expanded.Libraries[3].Requires)
+	require.Nil(t, expanded.Libraries[3].DirectRequires)
+	// the index itself keeps the direct dependencies
+	require.Equal(t, []string{"Display"}, index.Libraries[0].Requires)
+
+	// read back, the expanded requires don't compound
+	restoreDirectRequires(expanded.Libraries)
+	require.Equal(t, index.Libraries, expanded.Libraries)
+}
+
+func TestExpandedIndexKeepsDeniedOut(t *testing.T) {
+	defer func(original dependencyList) { deniedDeps = original }(deniedDeps)
+	deniedDeps = dependencyList{"App": {"GFX"}}
+
+	index := &indexOutput{Libraries: []indexLibrary{
+		{LibraryName: "App", Requires: []string{"Display"}},
+		{LibraryName: "Display", Requires: []string{"GFX"}},
+		{LibraryName: "GFX", Requires: []string{"BusIO"}},
+	}}
+	require.Equal(t, []string{"Display", "BusIO"}, expandedIndex(index, 2).Libraries[0].Requires)
+}
+
+func TestAdjacency(t *testing.T) {
+	libraries := []indexLibrary{
+		{LibraryName: "Display", Requires: []string{"GFX", "BusIO"}},
+		{LibraryName: "GFX", Requires: []string{"BusIO"}},
+		{LibraryName: "BusIO"},
+	}
+
+	require.Equal(t, map[string]graphNode{
+		"Display": {Requires: []string{"GFX", "BusIO"}, RequiredBy: []string{}},
+		"GFX":     {Requires: []string{"BusIO"}, RequiredBy: []string{"Display"}},
+		"BusIO":   {Requires: []string{}, RequiredBy: []string{"Display", "GFX"}},
+	}, buildDependencyGraph(libraries).adjacency())
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// Dependencies listed by hand for some libraries, keyed by library name, as
+// in {"Weather Station": ["SD"]}
+type dependencyList map[string][]string
+
+// dependencies known to be false positives, given with -deny-deps
+var deniedDeps dependencyList
+
+// dependencies the analysis can't detect, given with -force-deps
+var forcedDeps dependencyList
+
+func loadDependencyList(file string) (dependencyList, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var list dependencyList
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("invalid dependency list in %s: %s", file, err)
+	}
+	return list, nil
+}
+
+// lookup returns the dependencies listed for library, whose name is compared
+// case insensitively
+func (list dependencyList) lookup(library string) []string {
+	var deps []string
+	for name, listed := range list {
+		if strings.EqualFold(name, library) {
+			deps = append(deps, listed...)
+		}
+	}
+	return deps
+}
+
+// denyDependencies strips from the requires of library the dependencies
+// -deny-deps lists for it
+func denyDependencies(library string, requires []string) []string {
+	denied := deniedDeps.lookup(library)
+	if len(denied) == 0 {
+		return requires
+	}
+	var kept []string
+	for _, dep := range requires {
+		if sliceContainsFold(denied, dep) {
+			if *verboseFlag {
+				fmt.Println("Dropping " + dep + " from the requires of " + library + ": denied by -deny-deps")
+			}
+			continue
+		}
+		kept = append(kept, dep)
+	}
+	return kept
+}
+
+// forceDependencies adds to the requires of library the dependencies
+// -force-deps lists for it, keeping them sorted and without duplicates
+func forceDependencies(library string, requires []string) []string {
+	forced := forcedDeps.lookup(library)
+	if len(forced) == 0 {
+		return requires
+	}
+	if *verboseFlag {
+		for _, dep := range forced {
+			if !sliceContainsFold(requires, dep) {
+				fmt.Println("Adding " + dep + " to the requires of " + library + ": forced by -force-deps")
+			}
+		}
+	}
+	return mergeDependencies(requires, forced)
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDenyDependencies(t *testing.T) {
+	folder, err := ioutil.TempDir("", "deny_deps")
+	require.NoError(t, err)
+	defer os.RemoveAll(folder)
+	file := filepath.Join(folder, "deny.json")
+	require.NoError(t, ioutil.WriteFile(file, []byte(`{"weather station": ["sd"]}`), 0666))
+
+	list, err := loadDependencyList(file)
+	require.NoError(t, err)
+	defer func(original dependencyList) { deniedDeps = original }(deniedDeps)
+	deniedDeps = list
+
+	require.Equal(t, []string{"Adafruit Unified Sensor"}, denyDependencies("Weather Station", []string{"Adafruit Unified Sensor", "SD"}))
+	require.Equal(t, []string{"SD"}, denyDependencies("Logger", []string{"SD"}))
+}
+
+func TestForceDependencies(t *testing.T) {
+	defer func(original dependencyList) { forcedDeps = original }(forcedDeps)
+	forcedDeps = dependencyList{"Weather Station": {"SD", "Wire"}}
+
+	require.Equal(t, []string{"Adafruit Unified Sensor", "SD", "Wire"}, forceDependencies("weather station", []string{"SD", "Adafruit Unified Sensor"}))
+	require.Equal(t, []string{"SD"}, forceDependencies("Logger", []string{"SD"}))
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// DOWNLOAD_RETRIES is how many times a download failing with a server error
+// is tried again
+const DOWNLOAD_RETRIES = 2
+
+// archiveDownloader fetches library archives, keeping them in cacheFolder so
+// that they are downloaded only once across runs. It's safe to use from
+// several goroutines.
+type archiveDownloader struct {
+	cacheFolder string
+	client      *http.Client
+	retryDelay  time.Duration
+}
+
+func newArchiveDownloader(cacheFolder string, timeout time.Duration) (*archiveDownloader, error) {
+	if err := os.MkdirAll(cacheFolder, os.FileMode(0755)); err != nil {
+		return nil, err
+	}
+	return &archiveDownloader{cacheFolder: cacheFolder, client: &http.Client{Timeout: timeout}, retryDelay: time.Second}, nil
+}
+
+// cachePath is where the archive at url is kept: the hash of the url avoids
+// clashes between archives with the same name on different hosts
+func (d *archiveDownloader) cachePath(url string) string {
+	sum := sha256.Sum256([]byte(url))
+	return filepath.Join(d.cacheFolder, hex.EncodeToString(sum[:8])+"-"+path.Base(url))
+}
+
+// download returns the path of the archive at url, downloading it unless
+// it's already in the cache. Network and server errors are retried.
+func (d *archiveDownloader) download(url string) (string, error) {
+	cached := d.cachePath(url)
+	if _, err := os.Stat(cached); err == nil {
+		return cached, nil
+	}
+
+	var err error
+	for try := 0; try <= DOWNLOAD_RETRIES; try++ {
+		if try > 0 {
+			time.Sleep(d.retryDelay * time.Duration(try))
+		}
+		var retry bool
+		retry, err = d.fetch(url, cached)
+		if err == nil || !retry {
+			break
+		}
+	}
+	if err != nil {
+		return "", err
+	}
+	return cached, nil
+}
+
+// fetch downloads url to cached, and tells if a failure is worth retrying
+func (d *archiveDownloader) fetch(url string, cached string) (bool, error) {
+	response, err := d.client.Get(url)
+	if err != nil {
+		return true, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		err := errors.New("cannot download " + url + ": " + response.Status)
+		return response.StatusCode >= 500, err
+	}
+
+	temp, err := ioutil.TempFile(d.cacheFolder, ".download")
+	if err != nil {
+		return false, err
+	}
+	written, err := io.Copy(temp, response.Body)
+	if err == nil && response.ContentLength >= 0 && written != response.ContentLength {
+		err = errors.New("cannot download " + url + ": got " + strconv.FormatInt(written, 10) + " of " + strconv.FormatInt(response.ContentLength, 10) + " bytes")
+	}
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(temp.Name(), cached)
+	}
+	if err != nil {
+		os.Remove(temp.Name())
+		return true, err
+	}
+	return false, nil
+}
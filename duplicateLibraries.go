@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"arduino.cc/builder/types"
+)
+
+// Installed libraries claiming the same RealName
+type duplicateLibrary struct {
+	RealName string
+	Copies   []installedCopy
+}
+
+type installedCopy struct {
+	Folder  string
+	Version string
+}
+
+// findDuplicateLibraries returns, sorted by name, the libraries living in
+// folders whose RealName (case insensitively) is claimed by more than one
+// folder, be it another version or a fork: the index entry they match, and
+// the folder linked under RealName, depend on which one the loader happened
+// to list first.
+func findDuplicateLibraries(libraries []*types.Library, folders []string) []duplicateLibrary {
+	byName := make(map[string]*duplicateLibrary)
+	var keys []string
+	for _, library := range libraries {
+		if sourcePriority(library, folders) == len(folders) {
+			continue
+		}
+		key := strings.ToLower(library.RealName)
+		if _, ok := byName[key]; !ok {
+			byName[key] = &duplicateLibrary{RealName: library.RealName}
+			keys = append(keys, key)
+		}
+		byName[key].Copies = append(byName[key].Copies, installedCopy{Folder: library.Folder, Version: library.Version})
+	}
+	sort.Strings(keys)
+
+	var duplicates []duplicateLibrary
+	for _, key := range keys {
+		copies := byName[key].Copies
+		if len(copies) > 1 {
+			sort.Slice(copies, func(i, j int) bool { return copies[i].Folder < copies[j].Folder })
+			duplicates = append(duplicates, *byName[key])
+		}
+	}
+	return duplicates
+}
+
+func printDuplicateLibraries(duplicates []duplicateLibrary) {
+	for _, duplicate := range duplicates {
+		fmt.Println("Warning: " + duplicate.RealName + " is installed in more than one folder:")
+		for _, installed := range duplicate.Copies {
+			fmt.Println("  " + installed.Folder + " (" + installed.Version + ")")
+		}
+	}
+}
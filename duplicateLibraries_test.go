@@ -0,0 +1,25 @@
+package main
+
+import (
+	"testing"
+
+	"arduino.cc/builder/types"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFindDuplicateLibraries(t *testing.T) {
+	libraries := []*types.Library{
+		{RealName: "SD", Version: "1.2.2", Folder: "/libs/SD"},
+		{RealName: "sd", Version: "1.2.2", Folder: "/libs/SD-fork"},
+		{RealName: "Versioned", Version: "1.0.0", Folder: "/libs/Versioned-1.0.0"},
+		{RealName: "Versioned", Version: "1.1.0", Folder: "/libs/Versioned-1.1.0"},
+		{RealName: "SPI", Version: "1.0", Folder: "/hardware/avr/libraries/SPI"},
+		{RealName: "SPI", Version: "1.0", Folder: "/hardware/sam/libraries/SPI"},
+	}
+
+	require.Equal(t, []duplicateLibrary{
+		{RealName: "SD", Copies: []installedCopy{{Folder: "/libs/SD", Version: "1.2.2"}, {Folder: "/libs/SD-fork", Version: "1.2.2"}}},
+		{RealName: "Versioned", Copies: []installedCopy{{Folder: "/libs/Versioned-1.0.0", Version: "1.0.0"}, {Folder: "/libs/Versioned-1.1.0", Version: "1.1.0"}}},
+	}, findDuplicateLibraries(libraries, []string{"/libs"}))
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"strings"
+
+	"arduino.cc/builder/i18n"
+)
+
+// One line of the -error-report file
+type errorReportEntry struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	FQBN    string `json:"fqbn"`
+	Arch    string `json:"arch"`
+	Reason  string `json:"reason"`
+	Error   string `json:"error,omitempty"`
+	// what the compiler printed during the failed build
+	Output string `json:"output,omitempty"`
+}
+
+// outputCollector is the logger of a build whose compiler errors are kept
+// for the -error-report
+type outputCollector struct {
+	i18n.Logger
+	output bytes.Buffer
+}
+
+func (c *outputCollector) Output() io.Writer {
+	return &c.output
+}
+
+// buildFailure is a failed build, along with what the compiler printed
+type buildFailure struct {
+	err    error
+	output string
+}
+
+func (f *buildFailure) Error() string {
+	return f.err.Error()
+}
+
+// Writes every failure as a json object on its own line
+type errorReport struct {
+	file    *os.File
+	encoder *json.Encoder
+}
+
+func newErrorReport(path string) (*errorReport, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return &errorReport{file: file, encoder: json.NewEncoder(file)}, nil
+}
+
+func (r *errorReport) Write(entry errorReportEntry) error {
+	return r.encoder.Encode(entry)
+}
+
+func (r *errorReport) Close() error {
+	return r.file.Close()
+}
+
+// archOfFQBN returns the architecture part of a package:arch:board FQBN
+func archOfFQBN(fqbn string) string {
+	parts := strings.Split(fqbn, ":")
+	if len(parts) < 2 {
+		return ""
+	}
+	return parts[1]
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+const EVENT_START = "start"
+const EVENT_DEPS = "deps"
+const EVENT_FAILURE = "failure"
+const EVENT_SKIP = "skip"
+
+// Event emitted, one json object per line, with -logger json
+type logEvent struct {
+	Time    string   `json:"time"`
+	Level   string   `json:"level"`
+	Event   string   `json:"event"`
+	Library string   `json:"library,omitempty"`
+	Version string   `json:"version,omitempty"`
+	Message string   `json:"message,omitempty"`
+	Deps    []string `json:"deps,omitempty"`
+}
+
+// eventLogger writes the events of a run as json lines. It's safe to use
+// from several goroutines.
+type eventLogger struct {
+	mutex   sync.Mutex
+	encoder *json.Encoder
+}
+
+// events is nil unless -logger json was given
+var events *eventLogger
+
+func newEventLogger(w io.Writer) *eventLogger {
+	return &eventLogger{encoder: json.NewEncoder(w)}
+}
+
+func (l *eventLogger) log(event logEvent) {
+	if l == nil {
+		return
+	}
+	if event.Time == "" {
+		event.Time = time.Now().UTC().Format(time.RFC3339)
+	}
+	if event.Level == "" {
+		event.Level = "info"
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.encoder.Encode(event)
+}
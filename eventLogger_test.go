@@ -0,0 +1,30 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventLogger(t *testing.T) {
+	var output bytes.Buffer
+	logger := newEventLogger(&output)
+	logger.log(logEvent{Event: EVENT_START, Library: "SD", Version: "1.2.2"})
+	logger.log(logEvent{Level: "error", Event: EVENT_FAILURE, Library: "SD", Version: "1.2.2", Message: "sketch failed to compile"})
+
+	lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+	require.Len(t, lines, 2)
+	var event logEvent
+	require.NoError(t, json.Unmarshal([]byte(lines[1]), &event))
+	require.Equal(t, "error", event.Level)
+	require.Equal(t, EVENT_FAILURE, event.Event)
+	require.Equal(t, "sketch failed to compile", event.Message)
+	require.NotEmpty(t, event.Time)
+
+	// disabled
+	var disabled *eventLogger
+	disabled.log(logEvent{Event: EVENT_SKIP})
+}
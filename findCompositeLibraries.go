@@ -5,6 +5,7 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"regexp"
 	"sort"
 	"strings"
 )
@@ -34,14 +35,7 @@ func saveDuplicateHeaders(path string, info os.FileInfo, err error) error {
 			return nil
 		}
 
-		libName := strings.TrimSuffix(completePath, "/src")
-		splt := strings.Split(libName, "/")
-		pcs := strings.Split(splt[len(splt)-1], "-")
-		if len(pcs) > 1 {
-			libName = strings.Join(pcs[0:len(pcs)-1], "-")
-		} else {
-			libName = strings.Join(pcs, "")
-		}
+		libName := libraryNameFromFolder(filepath.Base(strings.TrimSuffix(completePath, "/src")))
 
 		lowerCaseName := strings.ToLower(info.Name())
 
@@ -52,6 +46,14 @@ func saveDuplicateHeaders(path string, info os.FileInfo, err error) error {
 	return nil
 }
 
+var folderVersionSuffix = regexp.MustCompile(`-v?[0-9]+(\.[0-9]+)+$`)
+
+// libraryNameFromFolder strips the version from a Name-x.x.x folder name,
+// leaving alone the hyphens that are part of the name itself
+func libraryNameFromFolder(folder string) string {
+	return folderVersionSuffix.ReplaceAllString(folder, "")
+}
+
 func sliceContains(search string, slice []string) bool {
 	for _, elem := range slice {
 		if search == elem {
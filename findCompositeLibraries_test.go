@@ -0,0 +1,14 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLibraryNameFromFolder(t *testing.T) {
+	require.Equal(t, "Foo", libraryNameFromFolder("Foo-1.2.3"))
+	require.Equal(t, "Adafruit-GFX-Library", libraryNameFromFolder("Adafruit-GFX-Library-1.10.12"))
+	require.Equal(t, "NoVersion", libraryNameFromFolder("NoVersion"))
+	require.Equal(t, "Hyphenated-Name", libraryNameFromFolder("Hyphenated-Name"))
+}
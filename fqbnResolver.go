@@ -0,0 +1,207 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"strings"
+	"sync"
+
+	"arduino.cc/builder"
+	"arduino.cc/builder/types"
+	"arduino.cc/builder/utils"
+)
+
+const DEFAULT_FQBN = "arduino:avr:uno"
+
+// A library whose name matches Pattern (see path.Match) is always compiled
+// for FQBN, whatever architectures it declares
+type fqbnOverride struct {
+	Pattern string `json:"pattern"`
+	FQBN    string `json:"fqbn"`
+}
+
+// Libraries needing a very specific board
+var defaultFQBNOverrides = []fqbnOverride{
+	{Pattern: "*Robot*Control*", FQBN: "arduino:avr:robotControl"},
+	{Pattern: "*Robot*", FQBN: "arduino:avr:robotMotor"},
+	{Pattern: "*Adafruit*Playground*", FQBN: "arduino:avr:circuitplay32u4cat"},
+}
+
+// Overrides in use, the ones from -library-fqbn-overrides first
+var fqbnOverrides = defaultFQBNOverrides
+
+// Boards found in the hardware folders, as package:arch:board. While nil,
+// every board is taken as installed.
+var installedBoards map[string]bool
+
+// boards not installed already warned about
+var missingBoards = struct {
+	sync.Mutex
+	warned map[string]bool
+}{warned: make(map[string]bool)}
+
+// loadInstalledBoards lists the boards of all the platforms in the hardware
+// folders of ctx
+func loadInstalledBoards(ctx *types.Context) (map[string]bool, error) {
+	hardwareCtx := &types.Context{HardwareFolders: ctx.HardwareFolders}
+	if err := (&builder.HardwareLoader{}).Run(hardwareCtx); err != nil {
+		return nil, err
+	}
+	boards := make(map[string]bool)
+	for _, targetPackage := range hardwareCtx.Hardware.Packages {
+		for _, platform := range targetPackage.Platforms {
+			for _, board := range platform.Boards {
+				boards[targetPackage.PackageId+":"+platform.PlatformId+":"+board.BoardId] = true
+			}
+		}
+	}
+	return boards, nil
+}
+
+// boardInstalled tells if the board of fqbn is installed, warning once per
+// board when it isn't
+func boardInstalled(fqbn string) bool {
+	parts := strings.SplitN(fqbn, ":", 4)
+	if installedBoards == nil || len(parts) < 3 || installedBoards[strings.Join(parts[:3], ":")] {
+		return true
+	}
+	missingBoards.Lock()
+	defer missingBoards.Unlock()
+	if !missingBoards.warned[fqbn] {
+		missingBoards.warned[fqbn] = true
+		fmt.Println("Warning: board " + fqbn + " is not installed, the libraries needing it are compiled for " + DEFAULT_FQBN)
+		warnings.add(WARNING_BOARD_NOT_INSTALLED, 1)
+	}
+	return false
+}
+
+// Board menu options appended to the FQBN chosen for an architecture, as in
+// arch=option1=value1,option2=value2. The default ones can be replaced with
+// -fqbn-options.
+type fqbnOptions map[string]string
+
+var defaultFQBNOptions = fqbnOptions{
+	"esp8266": "CpuFrequency=80,UploadSpeed=115200,FlashSize=4M3M",
+}
+
+func (o fqbnOptions) String() string {
+	return fmt.Sprint(map[string]string(o))
+}
+
+func (o fqbnOptions) Set(value string) error {
+	parts := strings.SplitN(value, "=", 2)
+	if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" || strings.TrimSpace(parts[1]) == "" {
+		return fmt.Errorf("invalid FQBN options %q, expected <arch>=<options>", value)
+	}
+	o[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+	return nil
+}
+
+// withOptions appends to fqbn the options given for its architecture, unless
+// it already has options
+func (o fqbnOptions) withOptions(fqbn string) string {
+	parts := strings.Split(fqbn, ":")
+	if len(parts) != 3 || o[parts[1]] == "" {
+		return fqbn
+	}
+	return fqbn + ":" + o[parts[1]]
+}
+
+// Options in use
+var fqbnOptionsByArch = fqbnOptions{}
+
+func init() {
+	for arch, options := range defaultFQBNOptions {
+		fqbnOptionsByArch[arch] = options
+	}
+}
+
+// loadFQBNOverrides reads a json list of overrides and puts them before the
+// default ones
+func loadFQBNOverrides(file string) ([]fqbnOverride, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var overrides []fqbnOverride
+	if err := json.Unmarshal(data, &overrides); err != nil {
+		return nil, fmt.Errorf("invalid FQBN overrides in %s: %s", file, err)
+	}
+	for _, override := range overrides {
+		if _, err := path.Match(override.Pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern %q in %s: %s", override.Pattern, file, err)
+		}
+	}
+	return append(overrides, defaultFQBNOverrides...), nil
+}
+
+// matchFQBNOverride returns the FQBN of the first override matching name
+func matchFQBNOverride(overrides []fqbnOverride, name string) (string, bool) {
+	for _, override := range overrides {
+		if matched, _ := path.Match(override.Pattern, name); matched {
+			return override.FQBN, true
+		}
+	}
+	return "", false
+}
+
+// resolveFQBN picks the board a library gets compiled for: the one of the
+// first override matching its name, if any and installed, else one chosen
+// looking at its name and at the architectures it declares, where later
+// matches win over earlier ones, with the options given for its
+// architecture. The boolean is false if DEFAULT_FQBN was returned since
+// nothing matched, or since the board of the override is not installed.
+func resolveFQBN(name string, archs []string) (string, bool) {
+	if fqbn, ok := matchFQBNOverride(fqbnOverrides, name); ok {
+		if !boardInstalled(fqbn) {
+			return fqbnOptionsByArch.withOptions(DEFAULT_FQBN), false
+		}
+		return fqbn, true
+	}
+	return resolveArchFQBN(name, archs)
+}
+
+// resolveArchFQBN is resolveFQBN without the overrides, which pick a board
+// by library name whatever the architectures
+func resolveArchFQBN(name string, archs []string) (string, bool) {
+	fqbn := ""
+
+	if (len(archs) > 0 && archs[0] == "*") || utils.SliceContains(archs, "avr") {
+		fqbn = "arduino:avr:micro"
+	}
+	if strings.Contains(name, "Yun") {
+		fqbn = "arduino:avr:yun"
+	}
+	if utils.SliceContains(archs, "sam") {
+		fqbn = "arduino:sam:arduino_due_x_dbg"
+	}
+	if utils.SliceContains(archs, "samd") {
+		fqbn = "arduino:samd:mkr1000"
+		if strings.Contains(name, "Fox") {
+			fqbn = "arduino:samd:mkrfox1200"
+		}
+	}
+	if utils.SliceContains(archs, "arc32") {
+		fqbn = "Intel:arc32:arduino_101"
+	}
+	if utils.SliceContains(archs, "esp8266") {
+		fqbn = "esp8266:esp8266:nodemcuv2"
+	}
+
+	if fqbn == "" {
+		return fqbnOptionsByArch.withOptions(DEFAULT_FQBN), false
+	}
+	return fqbnOptionsByArch.withOptions(fqbn), true
+}
+
+func printArchsMapping(libraries []indexLibrary) {
+	for _, lib := range libraries {
+		fqbn, matched := resolveFQBN(lib.LibraryName, lib.Architectures)
+		if !matched {
+			fqbn = "FALLBACK (" + fqbn + ")"
+		}
+		fmt.Printf("%s %s %v -> %s\n", lib.LibraryName, lib.Version, lib.Architectures, fqbn)
+	}
+}
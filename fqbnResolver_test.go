@@ -0,0 +1,78 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolveFQBNDefaultOverrides(t *testing.T) {
+	fqbn, matched := resolveFQBN("Robot Control", []string{"sam"})
+	require.True(t, matched)
+	require.Equal(t, "arduino:avr:robotControl", fqbn)
+
+	fqbn, _ = resolveFQBN("Robot IR Remote", []string{"avr"})
+	require.Equal(t, "arduino:avr:robotMotor", fqbn)
+
+	fqbn, _ = resolveFQBN("Adafruit Circuit Playground", []string{"avr"})
+	require.Equal(t, "arduino:avr:circuitplay32u4cat", fqbn)
+
+	fqbn, _ = resolveFQBN("Servo", []string{"avr"})
+	require.Equal(t, "arduino:avr:micro", fqbn)
+}
+
+func TestFQBNOverridePattern(t *testing.T) {
+	folder, err := ioutil.TempDir("", "fqbn_overrides")
+	require.NoError(t, err)
+	defer os.RemoveAll(folder)
+
+	file := filepath.Join(folder, "overrides.json")
+	require.NoError(t, ioutil.WriteFile(file, []byte(`[{"pattern": "Arduino_MKR*", "fqbn": "arduino:samd:mkrwifi1010"}]`), 0666))
+
+	overrides, err := loadFQBNOverrides(file)
+	require.NoError(t, err)
+
+	fqbn, ok := matchFQBNOverride(overrides, "Arduino_MKRENV")
+	require.True(t, ok)
+	require.Equal(t, "arduino:samd:mkrwifi1010", fqbn)
+
+	fqbn, ok = matchFQBNOverride(overrides, "Robot Motor")
+	require.True(t, ok)
+	require.Equal(t, "arduino:avr:robotMotor", fqbn)
+
+	_, ok = matchFQBNOverride(overrides, "MKR_Arduino")
+	require.False(t, ok)
+
+	require.NoError(t, ioutil.WriteFile(file, []byte(`[{"pattern": "[", "fqbn": "arduino:avr:uno"}]`), 0666))
+	_, err = loadFQBNOverrides(file)
+	require.Error(t, err)
+}
+
+func TestFQBNOptions(t *testing.T) {
+	fqbn, _ := resolveFQBN("ESP8266WiFi", []string{"esp8266"})
+	require.Equal(t, "esp8266:esp8266:nodemcuv2:CpuFrequency=80,UploadSpeed=115200,FlashSize=4M3M", fqbn)
+
+	options := fqbnOptions{}
+	require.NoError(t, options.Set("samd=usbstack=tinyusb"))
+	require.Error(t, options.Set("samd"))
+	require.Error(t, options.Set("=usbstack=tinyusb"))
+	require.Equal(t, "arduino:samd:mkr1000:usbstack=tinyusb", options.withOptions("arduino:samd:mkr1000"))
+	require.Equal(t, "arduino:avr:uno", options.withOptions("arduino:avr:uno"))
+	require.Equal(t, "arduino:samd:mkr1000:debug=on", options.withOptions("arduino:samd:mkr1000:debug=on"))
+}
+
+func TestResolveFQBNBoardNotInstalled(t *testing.T) {
+	defer func(original map[string]bool) { installedBoards = original }(installedBoards)
+	installedBoards = map[string]bool{"arduino:avr:uno": true, "arduino:avr:robotMotor": true}
+
+	fqbn, matched := resolveFQBN("Robot Control", []string{"sam"})
+	require.False(t, matched)
+	require.Equal(t, DEFAULT_FQBN, fqbn)
+
+	fqbn, matched = resolveFQBN("Robot IR Remote", []string{"avr"})
+	require.True(t, matched)
+	require.Equal(t, "arduino:avr:robotMotor", fqbn)
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"arduino.cc/builder/constants"
+	"arduino.cc/builder/types"
+)
+
+// Entry of the includes cache the builder leaves in the build folder: the
+// #include found in Sourcefile made it add Includepath to the include path
+type includeCacheEntry struct {
+	Sourcefile  string
+	Include     string
+	Includepath string
+}
+
+// appendIncludeReasons adds to reasons, for every library imported by the
+// last build except library itself, the #include lines which pulled it in.
+// Dependencies are named like in appendDependencies.
+func appendIncludeReasons(ctx *types.Context, library *types.Library, index []indexLibrary, reasons map[string][]string) (map[string][]string, error) {
+	data, err := ioutil.ReadFile(filepath.Join(ctx.BuildPath, constants.FILE_INCLUDES_CACHE))
+	if err != nil {
+		return reasons, err
+	}
+	var entries []includeCacheEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return reasons, err
+	}
+
+	for _, dep := range ctx.ImportedLibraries {
+		if strings.EqualFold(dep.RealName, library.RealName) {
+			continue
+		}
+		name := canonicalName(index, dep.RealName)
+		for _, entry := range entries {
+			if entry.Include == "" || filepath.Clean(entry.Includepath) != filepath.Clean(dep.SrcFolder) {
+				continue
+			}
+			if reasons == nil {
+				reasons = make(map[string][]string)
+			}
+			if !sliceContainsFold(reasons[name], entry.Include) {
+				reasons[name] = append(reasons[name], entry.Include)
+			}
+		}
+	}
+	return reasons, nil
+}
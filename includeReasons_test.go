@@ -0,0 +1,43 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"arduino.cc/builder/constants"
+	"arduino.cc/builder/types"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAppendIncludeReasons(t *testing.T) {
+	buildPath, err := ioutil.TempDir("", "build")
+	require.NoError(t, err)
+	defer os.RemoveAll(buildPath)
+
+	cache := `[
+		{"Sourcefile": "", "Include": "", "Includepath": "/core"},
+		{"Sourcefile": "/build/sketch/sketch.ino.cpp", "Include": "Display.h", "Includepath": "/libraries/Display/src"},
+		{"Sourcefile": "/libraries/Display/src/Display.cpp", "Include": "Adafruit_GFX.h", "Includepath": "/libraries/Adafruit_GFX_Library"},
+		{"Sourcefile": "/libraries/Display/src/Display.cpp", "Include": "Wire.h", "Includepath": "/avr/libraries/Wire/src"},
+		{"Sourcefile": "/build/sketch/sketch.ino.cpp", "Include": "", "Includepath": ""}
+	]`
+	require.NoError(t, ioutil.WriteFile(filepath.Join(buildPath, constants.FILE_INCLUDES_CACHE), []byte(cache), 0666))
+
+	library := &types.Library{RealName: "Display", SrcFolder: "/libraries/Display/src"}
+	ctx := &types.Context{BuildPath: buildPath, ImportedLibraries: []*types.Library{
+		library,
+		{RealName: "adafruit gfx library", SrcFolder: "/libraries/Adafruit_GFX_Library"},
+		{RealName: "Wire", SrcFolder: "/avr/libraries/Wire/src"},
+	}}
+	index := []indexLibrary{{LibraryName: "Adafruit GFX Library"}}
+
+	reasons, err := appendIncludeReasons(ctx, library, index, nil)
+	require.NoError(t, err)
+	require.Equal(t, map[string][]string{
+		"Adafruit GFX Library": {"Adafruit_GFX.h"},
+		"Wire":                 {"Wire.h"},
+	}, reasons)
+}
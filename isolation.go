@@ -0,0 +1,55 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"arduino.cc/builder/builder_utils"
+	"arduino.cc/builder/types"
+	"arduino.cc/builder/utils"
+)
+
+// isolateLibrary copies the library in a new temporary libraries folder,
+// under its RealName, and returns that libraries folder. The original
+// folder is never touched.
+func isolateLibrary(library *types.Library) (string, error) {
+	librariesFolder, err := ioutil.TempDir("", "isolated_libraries")
+	if err != nil {
+		return "", err
+	}
+	err = copyFolder(library.Folder, filepath.Join(librariesFolder, realNameFolder(library)))
+	if err != nil {
+		os.RemoveAll(librariesFolder)
+		return "", err
+	}
+	return librariesFolder, nil
+}
+
+func copyFolder(src, dst string) error {
+	return filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if path != src && utils.IsSCCSOrHiddenFile(info) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+
+		if info.IsDir() {
+			return os.MkdirAll(target, os.FileMode(0755))
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		return builder_utils.CopyFile(path, target)
+	})
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"arduino.cc/builder/types"
+	"arduino.cc/builder/utils"
+)
+
+// Libraries are analyzed by -jobs workers in parallel. The safety of this
+// relies on three rules:
+//
+// - every worker owns a shallow copy of the builder context, with its own
+//   BuildPath, so the state the builder keeps in the context while building
+//   is never shared; what the copies share (hardware, tools) is only read
+// - the index, the cache and the run statistics are only touched under
+//   analysis.mutex
+// - the symlinks to RealName are the only changes made to the libraries
+//   folders, and every build rescans them. Each folder has a read/write
+//   lock: an analysis holds the libraries folders shared from the moment it
+//   links the library (if it needs to) until it is over, and the folder the
+//   link lives in exclusively, so no other build ever sees the link, or sees
+//   it vanish halfway through loading the libraries. Libraries needing a
+//   link are thus analyzed one at a time per folder. If the link is already
+//   there, the library is built without it, as it happens when running
+//   sequentially. -isolate avoids sharing folders altogether.
+
+// folderLocks hands out a read/write lock per folder
+type folderLocks struct {
+	mutex sync.Mutex
+	locks map[string]*sync.RWMutex
+}
+
+func (l *folderLocks) get(folder string) *sync.RWMutex {
+	if abs, err := filepath.Abs(folder); err == nil {
+		folder = abs
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.locks == nil {
+		l.locks = make(map[string]*sync.RWMutex)
+	}
+	lock, ok := l.locks[folder]
+	if !ok {
+		lock = &sync.RWMutex{}
+		l.locks[folder] = lock
+	}
+	return lock
+}
+
+// hold locks all the given folders, shared but for exclusive (if not ""),
+// and returns the function unlocking them. Folders are always locked in the
+// same order, so that two holders can't wait for each other.
+func (l *folderLocks) hold(folders []string, exclusive string) func() {
+	byPath := make(map[string]bool)
+	for _, folder := range append(append([]string{}, folders...), exclusive) {
+		if folder == "" {
+			continue
+		}
+		if abs, err := filepath.Abs(folder); err == nil {
+			folder = abs
+		}
+		byPath[folder] = byPath[folder] || isSameFolder(folder, exclusive)
+	}
+	var paths []string
+	for path := range byPath {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	var unlocks []func()
+	for _, path := range paths {
+		lock := l.get(path)
+		if byPath[path] {
+			lock.Lock()
+			unlocks = append(unlocks, lock.Unlock)
+		} else {
+			lock.RLock()
+			unlocks = append(unlocks, lock.RUnlock)
+		}
+	}
+	return func() {
+		for idx := len(unlocks) - 1; idx >= 0; idx-- {
+			unlocks[idx]()
+		}
+	}
+}
+
+func isSameFolder(folder, other string) bool {
+	return other != "" && isInFolder(folder, other) && isInFolder(other, folder)
+}
+
+// workerContext copies ctx for the given worker, giving it its own build
+// folder. Without a build folder, the builder generates one from the sketch
+// location, which is already unique to every library.
+func workerContext(ctx *types.Context, job int) (*types.Context, error) {
+	workerCtx := *ctx
+	workerCtx.ImportedLibraries = nil
+	workerCtx.IncludeFolders = nil
+	if ctx.BuildPath != "" {
+		workerCtx.BuildPath = filepath.Join(ctx.BuildPath, "job"+strconv.Itoa(job))
+		if err := utils.EnsureFolderExists(workerCtx.BuildPath); err != nil {
+			return nil, err
+		}
+	}
+	return &workerCtx, nil
+}
+
+// expired tells if the -timeout-total deadline has passed
+func (a *analysis) expired() bool {
+	return !a.deadline.IsZero() && time.Now().After(a.deadline)
+}
+
+// stopped tells if no other library should be started, since the deadline
+// has passed or the run was aborted by -max-failures
+func (a *analysis) stopped() bool {
+	if a.expired() {
+		return true
+	}
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+	return a.aborted != ""
+}
+
+// analyzeLibraries analyzes all the libraries, using up to jobs workers.
+// Once stopped no other library is started: the ones being analyzed are
+// completed and the ones never started are counted in a.remaining.
+func (a *analysis) analyzeLibraries(libraries []*types.Library, jobs int) error {
+	if jobs <= 1 {
+		for idx, library := range libraries {
+			if a.stopped() {
+				a.remaining = len(libraries) - idx
+				break
+			}
+			a.analyzeAndFlush(a.ctx, library)
+		}
+		return nil
+	}
+
+	queue := make(chan *types.Library)
+	var wg sync.WaitGroup
+	for job := 0; job < jobs; job++ {
+		ctx, err := workerContext(a.ctx, job)
+		if err != nil {
+			close(queue)
+			wg.Wait()
+			return err
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for library := range queue {
+				a.analyzeAndFlush(ctx, library)
+			}
+		}()
+	}
+	for idx, library := range libraries {
+		if a.stopped() {
+			a.remaining = len(libraries) - idx
+			break
+		}
+		queue <- library
+	}
+	close(queue)
+	wg.Wait()
+	return nil
+}
+
+// analyzeInBatches analyzes the libraries batchSize at a time. Between two
+// batches the results are saved and reset is called to start the next batch
+// from a clean state. A batchSize of 0 means a single batch.
+func (a *analysis) analyzeInBatches(libraries []*types.Library, jobs int, batchSize int, reset func(batch []*types.Library) error) error {
+	if batchSize <= 0 {
+		return a.analyzeLibraries(libraries, jobs)
+	}
+	for start := 0; start < len(libraries); start += batchSize {
+		end := start + batchSize
+		if end > len(libraries) {
+			end = len(libraries)
+		}
+		batch := libraries[start:end]
+		if start > 0 {
+			if a.stopped() {
+				a.remaining = len(libraries) - start
+				return nil
+			}
+			a.mutex.Lock()
+			a.flushed = a.analyzed
+			a.mutex.Unlock()
+			a.save()
+			if err := reset(batch); err != nil {
+				return err
+			}
+		}
+		if err := a.analyzeLibraries(batch, jobs); err != nil {
+			return err
+		}
+		if a.remaining > 0 {
+			a.remaining += len(libraries) - end
+			return nil
+		}
+	}
+	return nil
+}
+
+// analyzeAndFlush analyzes a library, then saves the results if -flush-every
+// libraries were analyzed since the last save
+func (a *analysis) analyzeAndFlush(ctx *types.Context, library *types.Library) {
+	if *continueOnError {
+		a.analyzeLibrarySafely(ctx, library)
+	} else {
+		a.analyzeLibrary(ctx, library)
+	}
+
+	a.mutex.Lock()
+	due := *flushEvery > 0 && a.analyzed-a.flushed >= *flushEvery
+	if due {
+		a.flushed = a.analyzed
+	}
+	a.mutex.Unlock()
+	if due {
+		a.save()
+	}
+}
+
+// save writes the results analyzed so far. The index and the cache are
+// copied under a read lock, then written without holding it, so that the
+// other jobs can go on while a flush is in progress; saves are serialized so
+// an older snapshot never overwrites a newer one.
+func (a *analysis) save() {
+	a.saving.Lock()
+	defer a.saving.Unlock()
+
+	a.mutex.RLock()
+	indexJson := &indexOutput{Libraries: append([]indexLibrary{}, a.indexJson.Libraries...)}
+	previousRun := &indexLibrariesAnalyzed{Exists: copyFlags(a.previousRun.Exists), Failed: copyFlags(a.previousRun.Failed)}
+	a.mutex.RUnlock()
+
+	saveResults(indexJson, previousRun)
+}
+
+func copyFlags(flags map[string]bool) map[string]bool {
+	if flags == nil {
+		return nil
+	}
+	copied := make(map[string]bool, len(flags))
+	for key, value := range flags {
+		copied[key] = value
+	}
+	return copied
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"arduino.cc/builder/types"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWorkerContextHasItsOwnBuildPath(t *testing.T) {
+	buildPath, err := ioutil.TempDir("", "build")
+	require.NoError(t, err)
+	defer os.RemoveAll(buildPath)
+
+	ctx := &types.Context{BuildPath: buildPath, FQBN: "arduino:avr:uno", ImportedLibraries: []*types.Library{{Name: "SD"}}}
+	first, err := workerContext(ctx, 0)
+	require.NoError(t, err)
+	second, err := workerContext(ctx, 1)
+	require.NoError(t, err)
+
+	require.Equal(t, filepath.Join(buildPath, "job0"), first.BuildPath)
+	require.Equal(t, filepath.Join(buildPath, "job1"), second.BuildPath)
+	require.Empty(t, first.ImportedLibraries)
+
+	first.FQBN = "arduino:sam:arduino_due_x_dbg"
+	require.Equal(t, "arduino:avr:uno", ctx.FQBN)
+	require.Equal(t, "arduino:avr:uno", second.FQBN)
+}
+
+func TestAnalyzeLibrariesStopsAtDeadline(t *testing.T) {
+	libraries := []*types.Library{{Name: "SD"}, {Name: "Servo"}, {Name: "Wire"}}
+	for _, jobs := range []int{1, 2} {
+		a := &analysis{ctx: &types.Context{}, deadline: time.Now().Add(-time.Second)}
+		require.NoError(t, a.analyzeLibraries(libraries, jobs))
+		require.Equal(t, 3, a.remaining)
+		require.Equal(t, 0, a.analyzed)
+	}
+}
+
+func TestAnalyzeInBatchesCountsRemaining(t *testing.T) {
+	libraries := []*types.Library{{Name: "SD"}, {Name: "Servo"}, {Name: "Wire"}, {Name: "SPI"}, {Name: "EEPROM"}}
+	a := &analysis{ctx: &types.Context{}, deadline: time.Now().Add(-time.Second)}
+	resets := 0
+	require.NoError(t, a.analyzeInBatches(libraries, 1, 2, func(batch []*types.Library) error {
+		resets++
+		return nil
+	}))
+	require.Equal(t, 5, a.remaining)
+	require.Equal(t, 0, resets)
+}
+
+func TestAnalyzeLibrariesStopsAfterMaxFailures(t *testing.T) {
+	defer func(original int) { *maxFailuresFlag = original }(*maxFailuresFlag)
+	*maxFailuresFlag = 2
+
+	a := &analysis{ctx: &types.Context{}}
+	a.countFailure("arduino:sam:arduino_due_x_dbg", true)
+	a.countFailure("arduino:avr:micro", true)
+	a.countFailure("arduino:sam:arduino_due_x_dbg", false)
+	a.countFailure("arduino:avr:uno", true)
+	require.Contains(t, a.aborted, "compiled for avr")
+
+	libraries := []*types.Library{{Name: "SD"}, {Name: "Servo"}}
+	require.NoError(t, a.analyzeLibraries(libraries, 1))
+	require.Equal(t, 2, a.remaining)
+}
+
+func TestLinkedLibraryIsHiddenFromOtherJobs(t *testing.T) {
+	librariesFolder, err := ioutil.TempDir("", "libraries")
+	require.NoError(t, err)
+	defer os.RemoveAll(librariesFolder)
+	for _, name := range []string{"SD", "SpacedName"} {
+		require.NoError(t, copyFolder(filepath.Join("testdata", "libraries", name), filepath.Join(librariesFolder, name)))
+	}
+
+	defer func(original func(*types.Context) error) { runBuilder = original }(runBuilder)
+	var mutex sync.Mutex
+	var linksSeenBySD []string
+	runBuilder = func(ctx *types.Context) error {
+		if strings.Contains(filepath.Base(ctx.SketchLocation), "SpacedName") {
+			// give the other job time to build while the link exists
+			time.Sleep(50 * time.Millisecond)
+			return nil
+		}
+		entries, _ := ioutil.ReadDir(librariesFolder)
+		mutex.Lock()
+		defer mutex.Unlock()
+		for _, entry := range entries {
+			if entry.Mode()&os.ModeSymlink != 0 {
+				linksSeenBySD = append(linksSeenBySD, entry.Name())
+			}
+		}
+		return nil
+	}
+
+	libraries := []*types.Library{
+		{Name: "SpacedName", RealName: "My Spaced Lib (fork)", Version: "1.0.0", Folder: filepath.Join(librariesFolder, "SpacedName"), Archs: []string{"avr"}},
+		{Name: "SD", RealName: "SD", Version: "1.2.2", Folder: filepath.Join(librariesFolder, "SD"), Archs: []string{"avr"}},
+	}
+	index := indexOutput{Libraries: []indexLibrary{{LibraryName: "My Spaced Lib (fork)", Version: "1.0.0"}, {LibraryName: "SD", Version: "1.2.2"}}}
+	previousRun := indexLibrariesAnalyzed{Exists: make(map[string]bool), Failed: make(map[string]bool)}
+	a := &analysis{
+		ctx:            &types.Context{OtherLibrariesFolders: []string{librariesFolder}},
+		indexJson:      &index,
+		previousRun:    &previousRun,
+		sketchTemplate: DEFAULT_SKETCH_TEMPLATE,
+		matched:        make([]bool, len(index.Libraries)),
+	}
+
+	require.NoError(t, a.analyzeLibraries(libraries, 2))
+	require.Equal(t, 2, a.analyzed)
+	require.Empty(t, linksSeenBySD)
+}
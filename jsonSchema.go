@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xeipuuv/gojsonschema"
+)
+
+// loadJsonSchema reads the JSON Schema at path. References to other files
+// are resolved relative to it.
+func loadJsonSchema(path string) (*gojsonschema.Schema, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	schema, err := gojsonschema.NewSchema(gojsonschema.NewReferenceLoader("file://" + filepath.ToSlash(abs)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid schema %s: %s", path, err)
+	}
+	return schema, nil
+}
+
+// validateIndexSchema checks the raw index at path against the schema and
+// returns every violation found, sorted, each one prefixed with the path of
+// the offending value, as in libraries[42].size
+func validateIndexSchema(path string, timeout time.Duration, schema *gojsonschema.Schema) ([]string, error) {
+	var document []byte
+	err := withIndexReader(path, timeout, func(r io.Reader) error {
+		var err error
+		document, err = ioutil.ReadAll(r)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	result, err := schema.Validate(gojsonschema.NewBytesLoader(document))
+	if err != nil {
+		return nil, err
+	}
+	var violations []string
+	for _, resultError := range result.Errors() {
+		violations = append(violations, schemaPath(resultError.Field())+": "+resultError.Description())
+	}
+	sort.Strings(violations)
+	return violations, nil
+}
+
+// schemaPath turns the path of a value given by the validator, as in
+// libraries.42.size, into libraries[42].size
+func schemaPath(field string) string {
+	path := ""
+	for _, part := range strings.Split(field, ".") {
+		if _, err := strconv.Atoi(part); err == nil && path != "" {
+			path += "[" + part + "]"
+		} else if path == "" {
+			path = part
+		} else {
+			path += "." + part
+		}
+	}
+	return path
+}
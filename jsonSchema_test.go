@@ -0,0 +1,62 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateIndexSchema(t *testing.T) {
+	schema, err := loadJsonSchema("library_index.schema.json")
+	require.NoError(t, err)
+
+	folder, err := ioutil.TempDir("", "schema")
+	require.NoError(t, err)
+	defer os.RemoveAll(folder)
+
+	valid := filepath.Join(folder, "valid.json")
+	require.NoError(t, writeJsonAtomically(valid, indexOutput{Libraries: []indexLibrary{
+		{LibraryName: "SD", Version: "1.2.2", Requires: []string{"SPI"}, Size: 1024, Evidence: map[string]string{"SPI": EVIDENCE_SKETCH}},
+		{LibraryName: "Servo", Version: "1.1.0"},
+	}}))
+	violations, err := validateIndexSchema(valid, 0, schema)
+	require.NoError(t, err)
+	require.Empty(t, violations)
+
+	invalid := filepath.Join(folder, "invalid.json")
+	require.NoError(t, ioutil.WriteFile(invalid, []byte(`{"libraries": [
+		{"name": "SD", "version": "1.2.2", "author": "", "maintainer": "", "sentence": "", "url": "", "archiveFileName": "", "size": 10, "checksum": ""},
+		{"name": "Servo", "version": "", "author": "", "maintainer": "", "sentence": "", "archiveFileName": "", "size": "10", "checksum": "", "requires": ["SPI", 3], "evidence": {"SPI": true}}
+	]}`), 0666))
+	violations, err = validateIndexSchema(invalid, 0, schema)
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"libraries[1].evidence.SPI: Invalid type. Expected: string, given: boolean",
+		"libraries[1].requires[1]: Invalid type. Expected: string, given: integer",
+		"libraries[1].size: Invalid type. Expected: integer, given: string",
+		"libraries[1].version: String length must be greater than or equal to 1",
+		"libraries[1]: url is required",
+	}, violations)
+}
+
+func TestValidateIndexSchemaWithPattern(t *testing.T) {
+	folder, err := ioutil.TempDir("", "schema")
+	require.NoError(t, err)
+	defer os.RemoveAll(folder)
+
+	schemaFile := filepath.Join(folder, "schema.json")
+	require.NoError(t, ioutil.WriteFile(schemaFile, []byte(`{"title": "index", "type": "object", "properties": {"libraries": {"type": "array", "items": {"properties": {"name": {"type": "string", "pattern": "^[A-Z]"}}}}}}`), 0666))
+	schema, err := loadJsonSchema(schemaFile)
+	require.NoError(t, err)
+
+	index := filepath.Join(folder, "index.json")
+	require.NoError(t, ioutil.WriteFile(index, []byte(`{"libraries": [{"name": "SD"}, {"name": "servo"}]}`), 0666))
+	violations, err := validateIndexSchema(index, 0, schema)
+	require.NoError(t, err)
+	require.Len(t, violations, 1)
+	require.True(t, strings.HasPrefix(violations[0], "libraries[1].name: "), violations[0])
+}
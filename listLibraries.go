@@ -0,0 +1,19 @@
+package main
+
+import (
+	"fmt"
+
+	"arduino.cc/builder/types"
+)
+
+// printInstalledLibraries lists the libraries found by the builder and, for
+// each one, the index entry it is analyzed against, if any
+func printInstalledLibraries(libraries []*types.Library, index []indexLibrary) {
+	for _, library := range libraries {
+		match := "not in index"
+		if idx := indexJsonContains(index, library.RealName, library.Version); idx != -1 {
+			match = "index entry " + index[idx].LibraryName + " " + index[idx].Version
+		}
+		fmt.Printf("%s (%s) %s %s -> %s\n", library.Name, library.RealName, library.Version, library.Folder, match)
+	}
+}
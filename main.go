@@ -9,9 +9,11 @@ import (
 	"os/exec"
 	"os/signal"
 	"path/filepath"
+	"regexp"
 	"strconv"
 	"strings"
 	"syscall"
+	"time"
 
 	"arduino.cc/builder"
 	"arduino.cc/builder/gohasissues"
@@ -48,10 +50,15 @@ const FLAG_WARNINGS_ALL = "all"
 const FLAG_LOGGER = "logger"
 const FLAG_LOGGER_HUMAN = "human"
 const FLAG_LOGGER_MACHINE = "machine"
+const FLAG_LOGGER_JSON = "json"
 const FLAG_VERSION = "version"
 const FLAG_VID_PID = "vid-pid"
 const FLAG_JSON = "json"
 
+// exit code of a run stopped by -timeout-total, with libraries left to analyze
+const EXIT_TIMEOUT_TOTAL = 3
+const EXIT_TOO_MANY_FAILURES = 4
+
 type foldersFlag []string
 
 func (h *foldersFlag) String() string {
@@ -87,11 +94,46 @@ func (h *propertiesFlag) Set(value string) error {
 	return nil
 }
 
+type includesFlag []string
+
+func (h *includesFlag) String() string {
+	return fmt.Sprint(*h)
+}
+
+func (h *includesFlag) Set(value string) error {
+	*h = append(*h, strings.TrimSpace(value))
+	return nil
+}
+
+// -define values, as NAME or NAME=VALUE
+type definesFlag []string
+
+func (h *definesFlag) String() string {
+	return fmt.Sprint(*h)
+}
+
+func (h *definesFlag) Set(value string) error {
+	value = strings.TrimSpace(value)
+	name := strings.SplitN(value, "=", 2)[0]
+	if !macroName.MatchString(name) {
+		return fmt.Errorf("invalid define %q, expected NAME or NAME=VALUE", value)
+	}
+	*h = append(*h, value)
+	return nil
+}
+
+var macroName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
 var hardwareFoldersFlag foldersFlag
 var toolsFoldersFlag foldersFlag
 var librariesBuiltInFoldersFlag foldersFlag
 var librariesFoldersFlag foldersFlag
+var supportLibrariesFlag foldersFlag
+var customBuildPropertiesFlag propertiesFlag
+var prependIncludesFlag includesFlag
+var sketchDefinesFlag definesFlag
 var librariesJsonPath *string
+var outputFlag *string
 var buildPathFlag *string
 var verboseFlag *bool
 var forceRebuild *bool
@@ -99,7 +141,79 @@ var exampleFlag *bool
 var quietFlag *bool
 var debugLevelFlag *int
 var loggerFlag *string
+var coreAPIVersionFlag *string
+var ideVersionFlag *string
 var findComposite *bool
+var listArchsFlag *bool
+var statsOutFlag *string
+var skipExamplesOnFailure *bool
+var includeInternalDeps *bool
+var installOrderOut *string
+var sketchTemplatePath *string
+var normalizeMetadataFlag *bool
+var folderChecksumFlag *bool
+var csvOutFlag *string
+var continueOnError *bool
+var flushEvery *int
+var isolateFlag *bool
+var strictFlag *bool
+var reportDuplicates *bool
+var coreCacheFlag *string
+var computeSupportLevelFlag *bool
+var excludeArchsFlag *string
+var includeArchsFlag *string
+var errorReportFlag *string
+var resumeFlag *bool
+var maxDepsDelta *int
+var schemaFlag *string
+var listSkippedFlag *bool
+var jobsFlag *int
+var pprofFlag *string
+var cpuProfileFlag *string
+var memProfileFlag *string
+var withIncludeReasonsFlag *bool
+var onlyFailedFlag *bool
+var checksumAlgoFlag *string
+var verifyChecksumsFlag *bool
+var downloadCacheFlag *string
+var downloadTimeoutFlag *time.Duration
+var allowLicensesFlag *string
+var checkCategoriesFlag *bool
+var fixCategoriesFlag *bool
+var dependentsOutFlag *string
+var sketchOutFlag *string
+var dependencyDepthFlag *int
+var strictRequiresFlag *bool
+var noSymlinkFlag *bool
+var libraryPathFlag *string
+var manifestOutFlag *string
+var listLibrariesFlag *bool
+var libraryFQBNOverridesFlag *string
+var timeoutTotalFlag *time.Duration
+var depStabilityFlag *string
+var starArchsFlag *string
+var buildRetriesFlag *int
+var graphJsonFlag *string
+var verifyCleanFlag *bool
+var compareIndexFlag *string
+var compareOutFlag *string
+var repoFlag *string
+var workDirFlag *string
+var sortOutputFlag *bool
+var batchSizeFlag *int
+var withEvidenceFlag *bool
+var validateSchemaFlag *string
+var probeIncludesFlag *string
+var declaredOnlyFlag *bool
+var sinceFlag *string
+var sinceFileFlag *string
+var failOnFQBNFallbackFlag *bool
+var denyDepsFlag *string
+var forceDepsFlag *string
+var maxFailuresFlag *int
+var flattenRequiresFlag *bool
+var headerScanDepthFlag *int
+var dependencyFormatFlag *string
 
 // Output structure used to generate library_index.json file
 type indexOutput struct {
@@ -126,11 +240,24 @@ type indexLibrary struct {
 	Size            int64    `json:"size"`
 	Checksum        string   `json:"checksum"`
 
-	SupportLevel string `json:"supportLevel,omitempty"`
+	SupportLevel   string              `json:"supportLevel,omitempty"`
+	IncludeReasons map[string][]string `json:"includeReasons,omitempty"`
+	Evidence       map[string]string   `json:"evidence,omitempty"`
+	// platform and version the dependencies were found with
+	AnalyzedWith string `json:"analyzedWith,omitempty"`
+	// version of every dependency in requires the analysis compiled
+	// against, by lower case name, for -dependency-format constrained
+	RequiresVersions map[string]string `json:"-"`
+	// the requires found by the analysis, when -dependency-depth added the
+	// transitive ones to requires
+	DirectRequires []string `json:"directRequires,omitempty"`
 }
 
 type indexLibrariesAnalyzed struct {
 	Exists map[string]bool `json:"name"`
+	// libraries which failed in the last run they were analyzed in, keyed
+	// by failedCacheKey
+	Failed map[string]bool `json:"failed,omitempty"`
 }
 
 func init() {
@@ -138,28 +265,159 @@ func init() {
 	flag.Var(&toolsFoldersFlag, FLAG_TOOLS, "Specify a 'tools' folder. Can be added multiple times for specifying multiple 'tools' folders")
 	flag.Var(&librariesBuiltInFoldersFlag, FLAG_BUILT_IN_LIBRARIES, "Specify a built-in 'libraries' folder. These are low priority libraries. Can be added multiple times for specifying multiple built-in 'libraries' folders")
 	flag.Var(&librariesFoldersFlag, FLAG_LIBRARIES, "Specify a 'libraries' folder. Can be added multiple times for specifying multiple 'libraries' folders")
+	flag.Var(fqbnOptionsByArch, "fqbn-options", "Specify, as <arch>=<options>, board menu options to append to the FQBN chosen for that architecture, replacing the default ones. Can be added multiple times")
+	flag.Var(&supportLibrariesFlag, "support-libraries", "Specify a 'libraries' folder whose libraries are available to compile the others but are out of scope: they are never written in 'requires'. Can be added multiple times")
+	flag.Var(&customBuildPropertiesFlag, FLAG_PREFS, "Specify a custom preference as key=value. Can be added multiple times for specifying multiple custom preferences")
 	buildPathFlag = flag.String(FLAG_BUILD_PATH, "", "build path")
 	verboseFlag = flag.Bool(FLAG_VERBOSE, false, "if 'true' prints lots of stuff")
 	forceRebuild = flag.Bool("force", false, "if 'true' rebuilds all dependencies from scratch")
 	exampleFlag = flag.Bool("examples", false, "Also compile all the builtin example")
 	quietFlag = flag.Bool(FLAG_QUIET, false, "if 'true' doesn't print any warnings or progress or whatever")
 	debugLevelFlag = flag.Int(FLAG_DEBUG_LEVEL, builder.DEFAULT_DEBUG_LEVEL, "Turns on debugging messages. The higher, the chattier")
-	loggerFlag = flag.String(FLAG_LOGGER, FLAG_LOGGER_HUMAN, "Sets type of logger. Available values are '"+FLAG_LOGGER_HUMAN+"', '"+FLAG_LOGGER_MACHINE+"'")
-	librariesJsonPath = flag.String(FLAG_JSON, "", "specify the starting json file")
+	loggerFlag = flag.String(FLAG_LOGGER, FLAG_LOGGER_HUMAN, "Sets type of logger. Available values are '"+FLAG_LOGGER_HUMAN+"', '"+FLAG_LOGGER_MACHINE+"', '"+FLAG_LOGGER_JSON+"'. With '"+FLAG_LOGGER_JSON+"' the standard output only gets json lines describing the analysis, everything else goes to the standard error")
+	coreAPIVersionFlag = flag.String(FLAG_CORE_API_VERSION, "10800", "version of core APIs, used to populate the ARDUINO #define")
+	ideVersionFlag = flag.String(FLAG_IDE_VERSION, "1.8.0", "IDE version to report to the preprocessor, as in 1.8.0. Ignored if -"+FLAG_CORE_API_VERSION+" is given")
+	librariesJsonPath = flag.String(FLAG_JSON, "", "specify the starting json file, or its http(s) url. Gzipped files are accepted")
+	outputFlag = flag.String("output", "", "write the analyzed index to this file instead of overwriting the starting one. Mandatory if -"+FLAG_JSON+" is an url")
 	findComposite = flag.Bool("composite", false, "search for likely composite libraries")
+	listArchsFlag = flag.Bool("list-archs", false, "print the FQBN every library in the index would be compiled for, then exit")
+	statsOutFlag = flag.String("stats-out", "", "write the run statistics as json to this file")
+	skipExamplesOnFailure = flag.Bool("skip-examples-on-failure", false, "don't compile the examples of a library whose headers failed to compile")
+	includeInternalDeps = flag.Bool("include-internal-deps", false, "also list dependencies provided by cores or builtin libraries in 'requires'")
+	installOrderOut = flag.String("install-order-out", "", "write the libraries sorted so that dependencies come before their dependents to this file")
+	sketchTemplatePath = flag.String("sketch-template", "", "file used as body of the generated sketch, '"+SKETCH_TEMPLATE_INCLUDES+"' is replaced with the library includes")
+	normalizeMetadataFlag = flag.Bool("normalize-metadata", false, "normalize the author and maintainer fields of every library in the index")
+	folderChecksumFlag = flag.Bool("folder-checksum", false, "fill the empty checksum of libraries without an url with a checksum of the library folder")
+	csvOutFlag = flag.String("csv-out", "", "write one 'name,version,dependency,kind' row per dependency to this csv file. Only the libraries compiled by this run are exported, since the index doesn't keep the internal and support dependencies: cache hits and libraries skipped by -resume are left out")
+	continueOnError = flag.Bool("continue-on-error", false, "if the analysis of a library panics, mark it as failed and go on with the next one")
+	flushEvery = flag.Int("flush-every", 0, "save the index and the cache every N analyzed libraries")
+	isolateFlag = flag.Bool("isolate", false, "copy every library to a temporary libraries folder instead of symlinking it next to its original folder")
+	strictFlag = flag.Bool("strict", false, "exit with an error at the end of the run if any validation warning was emitted")
+	reportDuplicates = flag.Bool("report-duplicates", false, "after the analysis, search the libraries folders for likely composite libraries")
+	coreCacheFlag = flag.String("core-cache", "", "folder where compiled cores are cached, keyed by FQBN, and reused across libraries and runs")
+	computeSupportLevelFlag = flag.Bool("compute-support-level", false, "compile every library for all its architectures and fill its empty 'supportLevel' with verified, partial or broken")
+	excludeArchsFlag = flag.String("exclude-archs", "", "comma separated architectures to leave out of the analysis, libraries supporting only those are skipped")
+	includeArchsFlag = flag.String("include-archs", "", "comma separated architectures to restrict the analysis to, libraries supporting none of them are skipped")
+	errorReportFlag = flag.String("error-report", "", "write every compile failure as a json object per line to this file")
+	resumeFlag = flag.Bool("resume", false, "consider done the libraries whose entry in the index already has 'requires', even without a cache hit")
+	maxDepsDelta = flag.Int("max-deps-delta", -1, "warn when the number of dependencies of a library changes by more than this from the loaded index (fails with -strict)")
+	schemaFlag = flag.String("schema", SCHEMA_DEFAULT, "schema of the written index. Available values are '"+SCHEMA_DEFAULT+"', '"+SCHEMA_ARDUINO_CLI+"'")
+	listSkippedFlag = flag.Bool("list-skipped", false, "at the end of the run, list every library which was not analyzed and why")
+	jobsFlag = flag.Int("jobs", 1, "number of libraries to analyze in parallel")
+	pprofFlag = flag.String("pprof", "", "serve net/http/pprof on this address, like :6060")
+	cpuProfileFlag = flag.String("cpuprofile", "", "write a cpu profile of the run to this file")
+	memProfileFlag = flag.String("memprofile", "", "write a heap profile to this file at the end of the run")
+	flag.Var(&prependIncludesFlag, "prepend-include", "header to #include in the generated sketch before the headers of the library, like BoardConfig.h. Can be added multiple times; headers are included in the given order, always before the ones of the library")
+	flag.Var(&sketchDefinesFlag, "define", "macro to #define at the top of the generated sketch, as NAME or NAME=VALUE, like USE_TINYUSB. Can be added multiple times; defines come before every #include, -prepend-include ones too, so those headers see them as well")
+	withIncludeReasonsFlag = flag.Bool("with-include-reasons", false, "write, for every dependency of a library, the #include lines which pulled it in")
+	onlyFailedFlag = flag.Bool("only-failed", false, "only analyze again the libraries which failed in the last run")
+	checksumAlgoFlag = flag.String("checksum-algo", CHECKSUM_SHA256, "algorithm of the checksums computed by this tool. Available values are '"+CHECKSUM_SHA256+"', '"+CHECKSUM_SHA512+"'")
+	verifyChecksumsFlag = flag.Bool("verify-checksums", false, "download the archive of every library of the index, check it against its checksum and exit. The index is not modified")
+	downloadCacheFlag = flag.String("download-cache", filepath.Join(os.TempDir(), "library-archives"), "folder where downloaded archives are kept across runs")
+	downloadTimeoutFlag = flag.Duration("download-timeout", time.Minute, "timeout of every archive download")
+	allowLicensesFlag = flag.String("allow-licenses", "", "comma separated list of the allowed licenses, like MIT,Apache-2.0: libraries with other or no licenses are reported (and fail the run with -strict)")
+	checkCategoriesFlag = flag.Bool("check-categories", false, "report libraries whose category is not known to the Library Manager (and fail the run with -strict)")
+	fixCategoriesFlag = flag.Bool("fix-categories", false, "with -check-categories, replace the obvious typos in categories with the right category")
+	dependentsOutFlag = flag.String("dependents-out", "", "write as json, for every library, the libraries requiring it")
+	sketchOutFlag = flag.String("sketch-out", "", "keep a copy of the sketch generated for every library in <folder>/<library>/sketch.ino")
+	dependencyDepthFlag = flag.Int("dependency-depth", 0, "add to 'requires' the dependencies of the dependencies, up to this many levels beyond the direct ones. 0 keeps the direct dependencies only. The direct ones are also written to 'directRequires', which later runs read back")
+	strictRequiresFlag = flag.Bool("strict-requires", false, "drop from 'requires' the dependencies which are not in the index")
+	noSymlinkFlag = flag.Bool("no-symlink", false, "never create symlinks: libraries whose folder is not named after them are copied to a temporary libraries folder, like with -isolate. Slower, and the original folder stays visible to the builder too")
+	libraryPathFlag = flag.String("library-path", "", "analyze only the library in this folder, without any index or cache, and print its dependencies. With -output, write them as a one entry index")
+	manifestOutFlag = flag.String("manifest-out", "", "write as json a summary of the run: the index written, its size and checksum, the cache and how many libraries were analyzed, failed or skipped")
+	listLibrariesFlag = flag.Bool("list-libraries", false, "print the installed libraries found, with their name, real name, version, folder and matching index entry, then exit")
+	libraryFQBNOverridesFlag = flag.String("library-fqbn-overrides", "", "json file listing {\"pattern\": ..., \"fqbn\": ...} objects: libraries whose name matches a pattern are compiled for its FQBN, whatever their architectures. The first match wins and the builtin overrides come last")
+	timeoutTotalFlag = flag.Duration("timeout-total", 0, "stop starting new libraries once the run has lasted this long (e.g. 2h), save the results and exit with code "+strconv.Itoa(EXIT_TIMEOUT_TOTAL)+". A later run picks up the remaining libraries. 0 means no limit")
+	depStabilityFlag = flag.String("dep-stability", "", "write as json, for every library, the dependencies found by all of its compilation units (the generated sketch and, when compiled, the examples) and the ones found by any of them")
+	starArchsFlag = flag.String("star-archs", "", "comma separated architectures (e.g. avr,samd,esp8266) libraries declaring '*' are compiled for too, one board each, merging the dependencies found")
+	buildRetriesFlag = flag.Int("build-retries", 0, "build again, up to this many times, a build failed because of a transient error (locked or vanished files and the like), pausing a bit longer each time. Compilation errors are never retried")
+	graphJsonFlag = flag.String("graph-json", "", "write the dependency graph as a json adjacency list: for every library, the libraries it requires and the ones requiring it")
+	verifyCleanFlag = flag.Bool("verify-clean", false, "warn if the libraries folders changed, besides the symlinks made by the analysis, while analyzing a library")
+	compareIndexFlag = flag.String("compare-index", "", "compare the index with this reference index, printing for every library the dependencies added or removed and the support level changes, then exit")
+	compareOutFlag = flag.String("compare-out", "", "with -compare-index, also write the differences as json to this file")
+	repoFlag = flag.String("repo", "", "analyze the library checked out in this folder, as if installed by the library manager, without any index or cache, and warn if its 'depends' doesn't match the dependencies found. Implies -library-path")
+	workDirFlag = flag.String("work-dir", "", "generate the sketch of every library in <work-dir>/<library> instead of a random temporary folder, and keep it after the analysis")
+	sortOutputFlag = flag.Bool("sort-output", false, "write the index with the libraries sorted by name, then version, instead of keeping the order of the starting index")
+	batchSizeFlag = flag.Int("batch-size", 0, "analyze the libraries this many at a time: after every batch the results are saved and the build folder and the core cache are emptied, so long runs don't pile up builder state. 0 means a single batch")
+	withEvidenceFlag = flag.Bool("with-evidence", false, "write, for every dependency of a library, whether it was found by the generated sketch, by the examples or by both")
+	validateSchemaFlag = flag.String("validate-schema", "", "validate the index against this json schema (such as library_index.schema.json), print every violation and exit, with an error if any was found")
+	probeIncludesFlag = flag.String("probe-includes", "", "write as json, for every installed library, the headers it provides as they would be included, then exit")
+	declaredOnlyFlag = flag.Bool("declared-only", false, "don't compile anything: write as 'requires' of every library the libraries listed in the 'depends' of its library.properties")
+	sinceFlag = flag.String("since", "", "skip the libraries whose files didn't change after this time, given as RFC3339 (e.g. 2017-06-01T00:00:00Z)")
+	sinceFileFlag = flag.String("since-file", "", "like -since, reading the time from this file; a run which analyzed every library without failures writes its start time in it, for the next run to pick up")
+	failOnFQBNFallbackFlag = flag.Bool("fail-on-fqbn-fallback", false, "list the libraries no board matched, compiled for "+DEFAULT_FQBN+" instead, and exit with an error if there is any")
+	denyDepsFlag = flag.String("deny-deps", "", "json file mapping library names to the dependencies wrongly detected for them, which are left out of their requires")
+	forceDepsFlag = flag.String("force-deps", "", "json file mapping library names to dependencies always added to their requires, detected or not")
+	maxFailuresFlag = flag.Int("max-failures", 0, "stop starting new libraries once this many libraries in a row failed for the same architecture, save the results and exit with code "+strconv.Itoa(EXIT_TOO_MANY_FAILURES)+". 0 means no limit")
+	flattenRequiresFlag = flag.Bool("flatten-requires", false, "rename every detected dependency after the index entry with the most similar name, when no entry has the very same name, so the requires resolve in the Library Manager")
+	headerScanDepthFlag = flag.Int("header-scan-depth", 0, "when a library has no header in its folder or in src, search its subfolders for one down to this many levels, skipping deep vendored trees. Examples are always searched at any depth. 0 means no limit")
+	dependencyFormatFlag = flag.String("dependency-format", DEPENDENCY_FORMAT_NAME, "format of the written requires: '"+DEPENDENCY_FORMAT_NAME+"' for bare names, '"+DEPENDENCY_FORMAT_CONSTRAINED+"' for 'Name (>=version)' with the version of the dependency the analysis compiled against, when known")
 }
 
 func main() {
+	startTime := time.Now()
 	flag.Parse()
 
 	ctx := &types.Context{}
 
+	if *repoFlag != "" {
+		if *libraryPathFlag != "" {
+			printErrorMessageAndFlagUsage(errors.New("'repo' and 'library-path' are mutually exclusive"))
+		}
+		folder, err := installRepo(*repoFlag)
+		if err != nil {
+			printCompleteError(err)
+		}
+		defer os.RemoveAll(filepath.Dir(folder))
+		*libraryPathFlag = folder
+	}
+
 	// FLAG json
-	if *librariesJsonPath == "" {
+	if *librariesJsonPath == "" && *libraryPathFlag == "" {
 		fmt.Println("You need to pass the path of a library_index.json")
 		os.Exit(1)
 	}
 
+	if isURL(*librariesJsonPath) && *outputFlag == "" {
+		printErrorMessageAndFlagUsage(errors.New("Parameter 'output' is mandatory when '" + FLAG_JSON + "' is an url"))
+	}
+
+	if *schemaFlag != SCHEMA_DEFAULT && *schemaFlag != SCHEMA_ARDUINO_CLI {
+		printErrorMessageAndFlagUsage(errors.New("Unknown schema '" + *schemaFlag + "'"))
+	}
+
+	if *dependencyFormatFlag != DEPENDENCY_FORMAT_NAME && *dependencyFormatFlag != DEPENDENCY_FORMAT_CONSTRAINED {
+		printErrorMessageAndFlagUsage(errors.New("Unknown dependency format '" + *dependencyFormatFlag + "'"))
+	}
+
+	if _, err := newChecksumHash(*checksumAlgoFlag); err != nil {
+		printErrorMessageAndFlagUsage(err)
+	}
+
+	if *libraryFQBNOverridesFlag != "" {
+		overrides, err := loadFQBNOverrides(*libraryFQBNOverridesFlag)
+		if err != nil {
+			printCompleteError(err)
+		}
+		fqbnOverrides = overrides
+	}
+
+	if *denyDepsFlag != "" {
+		list, err := loadDependencyList(*denyDepsFlag)
+		if err != nil {
+			printCompleteError(err)
+		}
+		deniedDeps = list
+	}
+
+	if *forceDepsFlag != "" {
+		list, err := loadDependencyList(*forceDepsFlag)
+		if err != nil {
+			printCompleteError(err)
+		}
+		forcedDeps = list
+	}
+
 	// FLAG_HARDWARE
 	if hardwareFolders, err := toSliceOfUnquoted(hardwareFoldersFlag); err != nil {
 		printCompleteError(err)
@@ -169,6 +427,11 @@ func main() {
 	if len(ctx.HardwareFolders) == 0 {
 		printErrorMessageAndFlagUsage(errors.New("Parameter '" + FLAG_HARDWARE + "' is mandatory"))
 	}
+	if boards, err := loadInstalledBoards(ctx); err != nil {
+		fmt.Println("Warning: cannot list the installed boards: " + err.Error())
+	} else {
+		installedBoards = boards
+	}
 
 	// FLAG_TOOLS
 	if toolsFolders, err := toSliceOfUnquoted(toolsFoldersFlag); err != nil {
@@ -187,6 +450,23 @@ func main() {
 		ctx.OtherLibrariesFolders = librariesFolders
 	}
 
+	if *libraryPathFlag != "" {
+		libraryPath, err := filepath.Abs(*libraryPathFlag)
+		if err != nil {
+			printCompleteError(err)
+		}
+		ctx.OtherLibrariesFolders = utils.AppendIfNotPresent(ctx.OtherLibrariesFolders, filepath.Dir(libraryPath))
+	}
+
+	supportFolders, err := toSliceOfUnquoted(supportLibrariesFlag)
+	if err != nil {
+		printCompleteError(err)
+	}
+	if len(supportFolders) > 0 && len(ctx.OtherLibrariesFolders) == 0 {
+		printErrorMessageAndFlagUsage(errors.New("Parameter '" + FLAG_LIBRARIES + "' is mandatory with 'support-libraries'"))
+	}
+	ctx.OtherLibrariesFolders = utils.AppendIfNotPresent(ctx.OtherLibrariesFolders, supportFolders...)
+
 	// FLAG_BUILT_IN_LIBRARIES
 	if librariesBuiltInFolders, err := toSliceOfUnquoted(librariesBuiltInFoldersFlag); err != nil {
 		printCompleteError(err)
@@ -194,6 +474,18 @@ func main() {
 		ctx.BuiltInLibrariesFolders = librariesBuiltInFolders
 	}
 
+	// FLAG_PREFS
+	if customBuildProperties, err := toSliceOfUnquoted(customBuildPropertiesFlag); err != nil {
+		printCompleteError(err)
+	} else if len(customBuildProperties) > 0 {
+		for _, property := range customBuildProperties {
+			if !strings.Contains(property, "=") {
+				printErrorMessageAndFlagUsage(errors.New("Parameter '" + FLAG_PREFS + "' must be in the form key=value, got '" + property + "'"))
+			}
+		}
+		ctx.CustomBuildProperties = customBuildProperties
+	}
+
 	// FLAG_BUILD_PATH
 	buildPath, err := gohasissues.Unquote(*buildPathFlag)
 	if err != nil {
@@ -214,18 +506,35 @@ func main() {
 	ctx.BuildPath = buildPath
 
 	if *verboseFlag && *quietFlag {
+		fmt.Fprintln(os.Stderr, "-"+FLAG_VERBOSE+" and -"+FLAG_QUIET+" are mutually exclusive; defaulting to normal output")
 		*verboseFlag = false
 		*quietFlag = false
 	}
 
 	ctx.Verbose = *verboseFlag
 
-	ctx.ArduinoAPIVersion = "10800"
+	// FLAG_CORE_API_VERSION and FLAG_IDE_VERSION
+	if _, err := strconv.Atoi(*coreAPIVersionFlag); err != nil {
+		printErrorMessageAndFlagUsage(errors.New("Parameter '" + FLAG_CORE_API_VERSION + "' must be a number like 10800, got '" + *coreAPIVersionFlag + "'"))
+	}
+	ctx.ArduinoAPIVersion = *coreAPIVersionFlag
+	if !isFlagSet(FLAG_CORE_API_VERSION) {
+		apiVersion, err := ideVersionToAPIVersion(*ideVersionFlag)
+		if err != nil {
+			printErrorMessageAndFlagUsage(err)
+		}
+		ctx.ArduinoAPIVersion = apiVersion
+	}
 
 	if *debugLevelFlag > -1 {
 		ctx.DebugLevel = *debugLevelFlag
 	}
 
+	if *loggerFlag == FLAG_LOGGER_JSON {
+		events = newEventLogger(os.Stdout)
+		os.Stdout = os.Stderr
+	}
+
 	if *quietFlag {
 		ctx.SetLogger(i18n.NoopLogger{})
 	} else if *loggerFlag == FLAG_LOGGER_MACHINE {
@@ -234,249 +543,370 @@ func main() {
 		ctx.SetLogger(i18n.HumanLogger{})
 	}
 
+	stopProfiling, err := startProfiling()
+	if err != nil {
+		printCompleteError(err)
+	}
+	defer stopProfiling()
+
+	sketchTemplate, err := loadSketchTemplate(*sketchTemplatePath)
+	if err != nil {
+		printCompleteError(err)
+	}
+
 	if *findComposite {
 		printLibraries(ctx.OtherLibrariesFolders)
 		return
 	}
 
+	// clean up after interrupted runs before the libraries get loaded
+	removed, err := sweepLeftoverSymlinks(CREATED_SYMLINKS_FILE)
+	for _, link := range removed {
+		fmt.Println("removed leftover symlink " + link)
+	}
+	if err != nil {
+		fmt.Println("Cannot remove the leftover symlinks: " + err.Error())
+	}
+	createdSymlinks.path = CREATED_SYMLINKS_FILE
+
 	// Populate libraries, temporary FQBN
-	ctx.FQBN = "arduino:avr:uno"
+	ctx.FQBN = DEFAULT_FQBN
 	builder.RunParseHardwareAndDumpBuildProperties(ctx)
 
-	buildCachePath, _ := ioutil.TempDir("", "core_cache")
+	if ctx.Verbose {
+		fmt.Println("Library folders, highest priority first:")
+		for _, source := range librarySourcesByPriority(ctx) {
+			fmt.Println("  " + source)
+		}
+	}
+
+	buildCachePath := *coreCacheFlag
+	if buildCachePath == "" {
+		buildCachePath, _ = ioutil.TempDir("", "core_cache")
+	} else if err := utils.EnsureFolderExists(buildCachePath); err != nil {
+		printCompleteError(err)
+	}
 	ctx.BuildCachePath = buildCachePath
 
 	var indexJson indexOutput
 	var previousRun indexLibrariesAnalyzed
 	previousRun.Exists = make(map[string]bool)
+	previousRun.Failed = make(map[string]bool)
+
+	libraries := ctx.Libraries
 
-	prev, err := ioutil.ReadFile("cached_results.json")
-	if err == nil {
-		err = json.Unmarshal(prev, &previousRun)
+	duplicateLibraries := findDuplicateLibraries(ctx.Libraries, ctx.OtherLibrariesFolders)
+	printDuplicateLibraries(duplicateLibraries)
+	warnings.add(WARNING_DUPLICATE_LIBRARY, len(duplicateLibraries))
+
+	if *libraryPathFlag != "" {
+		// no index and no cache, just the given library
+		library := findLibraryInFolder(ctx.Libraries, *libraryPathFlag)
+		if library == nil {
+			fmt.Println("cannot find a library in " + *libraryPathFlag)
+			os.Exit(1)
+		}
+		libraries = []*types.Library{library}
+		indexJson.Libraries = []indexLibrary{indexEntryFromLibrary(library)}
+	} else {
+		if *validateSchemaFlag != "" {
+			schema, err := loadJsonSchema(*validateSchemaFlag)
+			if err != nil {
+				printCompleteError(err)
+			}
+			violations, err := validateIndexSchema(*librariesJsonPath, *downloadTimeoutFlag, schema)
+			if err != nil {
+				fmt.Println("cannot read index file " + *librariesJsonPath + ": " + err.Error())
+				os.Exit(1)
+			}
+			for _, violation := range violations {
+				fmt.Println(violation)
+			}
+			if len(violations) > 0 {
+				fmt.Println(fmt.Sprint(len(violations)) + " schema violations found")
+				os.Exit(1)
+			}
+			return
+		}
+
+		prev, err := ioutil.ReadFile(CACHED_RESULTS_FILE)
+		if err == nil {
+			err = json.Unmarshal(prev, &previousRun)
+			if err != nil {
+				fmt.Println(err.Error())
+				os.Exit(1)
+			}
+			migrated, dropped := migrateCacheKeys(previousRun.Exists, libraries)
+			if migrated > 0 || dropped > 0 {
+				fmt.Println(fmt.Sprint(migrated) + " entries of " + CACHED_RESULTS_FILE + " migrated to per-board keys, " + fmt.Sprint(dropped) + " dropped")
+			}
+		}
+
+		indexJson, err = loadIndex(*librariesJsonPath, *downloadTimeoutFlag)
 		if err != nil {
 			fmt.Println(err.Error())
 			os.Exit(1)
 		}
 	}
 
-	dec, _ := ioutil.ReadFile(*librariesJsonPath)
-
-	err = json.Unmarshal(dec, &indexJson)
-	if err != nil {
-		fmt.Println(err.Error())
-		os.Exit(1)
+	if *listArchsFlag {
+		printArchsMapping(indexJson.Libraries)
+		return
 	}
 
-	c := make(chan os.Signal, 2)
-	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
-	go func() {
-		<-c
-		tempJsonCTRL, err := json.MarshalIndent(&indexJson, "", "    ")
+	if *compareIndexFlag != "" {
+		reference, err := loadIndex(*compareIndexFlag, *downloadTimeoutFlag)
 		if err != nil {
 			fmt.Println(err.Error())
+			os.Exit(1)
 		}
-		ioutil.WriteFile(*librariesJsonPath, tempJsonCTRL, 0666)
-
-		tempPreviousRunJson, err := json.MarshalIndent(&previousRun, "", "    ")
-		if err != nil {
-			fmt.Println(err.Error())
+		diff := compareIndexes(reference.Libraries, indexJson.Libraries)
+		printIndexDiff(diff)
+		if *compareOutFlag != "" {
+			if err := writeJsonAtomically(*compareOutFlag, diff); err != nil {
+				fmt.Println(err.Error())
+				os.Exit(1)
+			}
 		}
-		ioutil.WriteFile("cached_results.json", tempPreviousRunJson, 0666)
-
-		fmt.Println("Exiting due to CTRL+C")
-		os.Exit(2)
-	}()
-
-	for _, library := range ctx.Libraries {
-
-		libIndex := indexJsonContains(indexJson.Libraries, library.RealName, library.Version)
+		return
+	}
 
-		if libIndex == -1 {
-			// library not in index, don't create dependency tree
-			continue
+	if *probeIncludesFlag != "" {
+		probed, err := probeIncludes(libraries)
+		if err == nil {
+			err = writeJsonAtomically(*probeIncludesFlag, probed)
 		}
-
-		if previousRun.Exists[library.Name] == true && *forceRebuild == false {
-			// we already have analyzed the dependencies, skip
-			// if forceRebuild == true, rebuild them anyway
-			continue
+		if err != nil {
+			printCompleteError(err)
 		}
+		return
+	}
 
-		// symlink the folder to a folder called RealName so it gets picked up
-		symlinkWithBestName := filepath.Join(library.Folder, "..", strings.Replace(library.RealName, " ", "_", -1))
-		usingSymlink := false
-		if symlinkWithBestName != library.Folder {
-			os.Symlink(library.Folder, symlinkWithBestName)
-			usingSymlink = true
-			fmt.Println("symlinking " + library.Folder + " to " + symlinkWithBestName)
-		}
+	if *listLibrariesFlag {
+		printInstalledLibraries(libraries, indexJson.Libraries)
+		return
+	}
 
-		if library.Archs[0] == "*" || utils.SliceContains(library.Archs, "avr") {
-			ctx.FQBN = "arduino:avr:micro"
-		}
-		if strings.Contains(library.Name, "Robot") {
-			if strings.Contains(library.Name, "Control") {
-				ctx.FQBN = "arduino:avr:robotControl"
-			} else {
-				ctx.FQBN = "arduino:avr:robotMotor"
-			}
-		}
-		if strings.Contains(library.Name, "Yun") {
-			ctx.FQBN = "arduino:avr:yun"
-		}
-		if strings.Contains(library.Name, "Adafruit") && strings.Contains(library.Name, "Playground") {
-			ctx.FQBN = "arduino:avr:circuitplay32u4cat"
-		}
-		if utils.SliceContains(library.Archs, "sam") {
-			ctx.FQBN = "arduino:sam:arduino_due_x_dbg"
-		}
-		if utils.SliceContains(library.Archs, "samd") {
-			ctx.FQBN = "arduino:samd:mkr1000"
-			if strings.Contains(library.Name, "Fox") {
-				ctx.FQBN = "arduino:samd:mkrfox1200"
-			}
-		}
-		if utils.SliceContains(library.Archs, "arc32") {
-			ctx.FQBN = "Intel:arc32:arduino_101"
-		}
-		if utils.SliceContains(library.Archs, "esp8266") {
-			ctx.FQBN = "esp8266:esp8266:nodemcuv2:CpuFrequency=80,UploadSpeed=115200,FlashSize=4M3M"
+	if *verifyChecksumsFlag {
+		downloader, err := newArchiveDownloader(*downloadCacheFlag, *downloadTimeoutFlag)
+		if err != nil {
+			printCompleteError(err)
 		}
+		mismatches, unverified := verifyChecksums(indexJson.Libraries, downloader, *jobsFlag)
+		printChecksumMismatches(mismatches)
+		warnings.add(WARNING_CHECKSUM_MISMATCH, len(mismatches))
+		warnings.add(WARNING_UNVERIFIED_CHECKSUM, len(unverified))
+		exitIfStrict(stopProfiling)
+		return
+	}
 
-		//wipe ctx.UsedLibraries
-		ctx.ImportedLibraries = ctx.ImportedLibraries[:0]
-		ctx.IncludeFolders = ctx.IncludeFolders[:0]
-
-		// create sketch, including all library headers
-		tempDir, _ := ioutil.TempDir("", "sketch"+library.Name)
+	duplicates := findDuplicateEntries(indexJson.Libraries)
+	printDuplicateEntries(duplicates)
+	warnings.add(WARNING_DUPLICATE_ENTRY, len(duplicates))
 
-		ctx.SketchLocation, _ = filepath.Abs(tempDir + "/sketch.ino")
+	if *checkCategoriesFlag {
+		invalid := findInvalidCategories(indexJson.Libraries)
+		printInvalidCategories(invalid)
+		if *fixCategoriesFlag {
+			fixCategories(indexJson.Libraries, invalid)
+		}
+		warnings.add(WARNING_INVALID_CATEGORY, len(invalid))
+	}
 
-		sketch := includeHeadersFromLibraryFolder(library)
+	if *allowLicensesFlag != "" {
+		disallowed := findDisallowedLicenses(indexJson.Libraries, splitList(*allowLicensesFlag))
+		printDisallowedLicenses(disallowed)
+		warnings.add(WARNING_DISALLOWED_LICENSE, len(disallowed))
+	}
 
-		sketch += "\nvoid loop(){}\nvoid setup(){}\n"
+	if *normalizeMetadataFlag {
+		normalizeMetadata(indexJson.Libraries)
+	}
 
-		ioutil.WriteFile(ctx.SketchLocation, []byte(sketch), 0666)
+	a := &analysis{
+		ctx:            ctx,
+		indexJson:      &indexJson,
+		previousRun:    &previousRun,
+		sketchTemplate: sketchTemplate,
+		matched:        make([]bool, len(indexJson.Libraries)),
+		supportFolders: supportFolders,
+	}
 
-		err = builder.RunBuilder(ctx)
+	c := make(chan os.Signal, 2)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-c
+		a.save()
 
-		safeTargets := []string{"arduino:avr:uno", "arduino:avr:mega:cpu=atmega2560"}
+		fmt.Println("Exiting due to CTRL+C")
+		os.Exit(2)
+	}()
 
-		tries := 0
-		for err != nil && tries < len(safeTargets) {
-			// try recompling for safer targets
-			ctx.FQBN = safeTargets[tries]
-			tries++
-			err = builder.RunBuilder(ctx)
+	if *timeoutTotalFlag > 0 {
+		a.deadline = startTime.Add(*timeoutTotalFlag)
+	}
+	if *sinceFlag != "" {
+		a.since, err = time.Parse(time.RFC3339, *sinceFlag)
+		if err != nil {
+			printErrorMessageAndFlagUsage(errors.New("Invalid value for 'since': " + err.Error()))
+		}
+	} else if *sinceFileFlag != "" {
+		a.since, err = readSinceFile(*sinceFileFlag)
+		if err != nil {
+			printCompleteError(err)
 		}
+	}
 
-		os.Remove(tempDir)
-		os.RemoveAll(tempDir)
-		// clean buildPath/libraries folder (at least)
-		//os.Remove(buildPath + "/libraries")
+	if *errorReportFlag != "" {
+		a.errors, err = newErrorReport(*errorReportFlag)
+		if err != nil {
+			printCompleteError(err)
+		}
+		defer a.errors.Close()
+	}
 
-		var deps []string
-		var internal_deps []string
+	// without -core-cache, the first library built for a board compiles its
+	// core for the following ones: warming the cache pays off only when it
+	// outlives the run
+	if *coreCacheFlag != "" {
+		precompileCores(ctx, a.fqbnsToBuild(libraries))
+	}
 
-		for _, dep := range ctx.ImportedLibraries {
-			if dep.RealName != library.RealName && !utils.SliceContains(deps, dep.RealName) && !utils.SliceContains(internal_deps, dep.RealName) {
-				if strings.Contains(dep.Folder, ctx.OtherLibrariesFolders[0]) {
-					deps = append(deps, dep.RealName)
-				} else {
-					internal_deps = append(internal_deps, dep.RealName)
-				}
-			}
+	err = a.analyzeInBatches(libraries, *jobsFlag, *batchSizeFlag, func(batch []*types.Library) error {
+		if err := resetBuildFolders(ctx); err != nil {
+			return err
 		}
+		if *coreCacheFlag != "" {
+			precompileCores(ctx, a.fqbnsToBuild(batch))
+		}
+		return nil
+	})
+	if err != nil {
+		printCompleteError(err)
+	}
 
-		//ctx.Libraries[i].Dependencies = deps
+	if *dependencyDepthFlag > 0 {
+		a.stats.DependencyDepth = *dependencyDepthFlag
+	}
+
+	saveResults(&indexJson, &previousRun)
 
-		fmt.Print("Library " + library.Name + " depends on: ")
-		fmt.Print(deps)
-		fmt.Print(" provided by lib manager and ")
-		fmt.Print(internal_deps)
-		fmt.Print(" provided by cores or builtin")
+	if *repoFlag != "" {
+		checkDeclaredDepends(libraries[0], indexJson.Libraries[0].Requires)
+	}
 
+	if *manifestOutFlag != "" && indexOutputPath() != "" {
+		cachePath := CACHED_RESULTS_FILE
+		if *libraryPathFlag != "" {
+			cachePath = ""
+		}
+		manifest, err := buildManifest(indexOutputPath(), cachePath, a.analyzed, &a.stats)
+		if err == nil {
+			err = writeJsonAtomically(*manifestOutFlag, manifest)
+		}
 		if err != nil {
-			fmt.Println(" but failed to compile on " + ctx.FQBN)
-		} else {
-			fmt.Println("")
+			fmt.Println(err.Error())
 		}
+	}
 
-		indexJson.Libraries[libIndex].Requires = deps
-
-		backup_fqbn := ""
+	if *installOrderOut != "" {
+		order, dropped := buildDependencyGraph(indexJson.Libraries).installOrder()
+		for _, edge := range dropped {
+			fmt.Println("Warning: dependency cycle, ignoring " + edge.From + " -> " + edge.To + " in install order")
+		}
+		err = writeInstallOrder(*installOrderOut, order)
+		if err != nil {
+			fmt.Println(err.Error())
+		}
+	}
 
-		if *exampleFlag == true {
+	if *dependentsOutFlag != "" {
+		err = writeJsonAtomically(*dependentsOutFlag, buildDependencyGraph(indexJson.Libraries).dependents())
+		if err != nil {
+			fmt.Println(err.Error())
+		}
+	}
 
-			// search for examples and compile them
-			libraryExamplesPath := filepath.Join(library.Folder, "examples")
-			examples, _ := findFilesInFolder(libraryExamplesPath, ".ino", true)
+	if *graphJsonFlag != "" {
+		err = writeJsonAtomically(*graphJsonFlag, buildDependencyGraph(indexJson.Libraries).adjacency())
+		if err != nil {
+			fmt.Println(err.Error())
+		}
+	}
 
-			var errors_examples []string
+	if *csvOutFlag != "" {
+		err = writeDependenciesCSV(*csvOutFlag, a.records)
+		if err != nil {
+			fmt.Println(err.Error())
+		}
+	}
 
-			for _, example := range examples {
-				ctx.SketchLocation = example
-				ctx.ImportedLibraries = ctx.ImportedLibraries[:0]
-				ctx.IncludeFolders = ctx.IncludeFolders[:0]
+	if *reportDuplicates {
+		var librariesFolders []string
+		librariesFolders = append(librariesFolders, ctx.OtherLibrariesFolders...)
+		librariesFolders = append(librariesFolders, ctx.BuiltInLibrariesFolders...)
+		printLibraries(librariesFolders)
+	}
 
-				if strings.Contains(strings.ToUpper(ctx.SketchLocation), "YUN") {
-					backup_fqbn = ctx.FQBN
-					ctx.FQBN = "arduino:avr:yun"
-				} else if backup_fqbn != "" {
-					ctx.FQBN = backup_fqbn
-				}
+	a.stats.Unmatched = collectUnmatched(indexJson.Libraries, a.matched)
+	printUnmatched(a.stats.Unmatched)
+	warnings.add(WARNING_UNMATCHED_ENTRY, len(a.stats.Unmatched))
 
-				err = builder.RunBuilder(ctx)
+	if *listSkippedFlag {
+		printSkipped(a.stats.Skipped)
+	}
 
-				if err != nil {
-					errors_examples = append(errors_examples, err.Error())
-				}
+	printInternalDeps(a.stats.InternalDeps)
+	printHeaderMatches(a.stats.HeaderMatches)
 
-				for _, dep := range ctx.ImportedLibraries {
-					if dep.RealName != library.RealName && !utils.SliceContains(deps, dep.RealName) && !utils.SliceContains(internal_deps, dep.RealName) {
-						if strings.Contains(dep.Folder, ctx.OtherLibrariesFolders[0]) {
-							deps = append(deps, dep.RealName)
-						} else {
-							internal_deps = append(internal_deps, dep.RealName)
-						}
-					}
-				}
-			}
-			fmt.Print("Examples for " + library.Name + " depends on: ")
-			fmt.Print(deps)
-			fmt.Print(" provided by lib manager and ")
-			fmt.Print(internal_deps)
-			fmt.Print(" provided by cores or builtin")
-
-			indexJson.Libraries[libIndex].CouldRequire = deps
-
-			if len(errors_examples) > 0 {
-				fmt.Println(" but " + strconv.Itoa(len(errors_examples)) + " failed to compile on " + ctx.FQBN)
-				// fmt.Println(errors_examples)
-			} else {
-				fmt.Println("")
-			}
+	if *statsOutFlag != "" {
+		err = writeStats(*statsOutFlag, &a.stats)
+		if err != nil {
+			fmt.Println(err.Error())
+		}
+	}
 
+	if *depStabilityFlag != "" {
+		err = writeDepStability(*depStabilityFlag, a.stability)
+		if err != nil {
+			fmt.Println(err.Error())
 		}
+	}
 
-		if usingSymlink {
-			os.RemoveAll(symlinkWithBestName)
+	if *sinceFileFlag != "" && a.remaining == 0 && len(a.stats.Failed) == 0 {
+		err = writeSinceFile(*sinceFileFlag, startTime)
+		if err != nil {
+			fmt.Println(err.Error())
 		}
+	}
 
-		previousRun.Exists[library.Name] = true
+	if *failOnFQBNFallbackFlag && len(a.stats.FQBNFallback) > 0 {
+		printFQBNFallback(a.stats.FQBNFallback)
+		stopProfiling()
+		os.Exit(1)
 	}
 
-	finalJson, err := json.MarshalIndent(&indexJson, "", "    ")
-	if err != nil {
-		fmt.Println(err.Error())
+	if a.aborted != "" {
+		fmt.Println("Run aborted: " + a.aborted + ", " + fmt.Sprint(a.remaining) + " libraries left to analyze")
+		stopProfiling()
+		os.Exit(EXIT_TOO_MANY_FAILURES)
 	}
-	ioutil.WriteFile(*librariesJsonPath, finalJson, 0666)
 
-	previousRunJson, err := json.MarshalIndent(&previousRun, "", "    ")
-	if err != nil {
-		fmt.Println(err.Error())
+	if a.remaining > 0 {
+		fmt.Println("Total timeout reached, " + fmt.Sprint(a.remaining) + " libraries left to analyze")
+		stopProfiling()
+		os.Exit(EXIT_TIMEOUT_TOTAL)
+	}
+
+	exitIfStrict(stopProfiling)
+}
+
+// requiresList returns what should be written as 'requires' of a library
+func requiresList(deps, internalDeps []string) []string {
+	if *includeInternalDeps {
+		return mergeDependencies(deps, internalDeps)
 	}
-	ioutil.WriteFile("cached_results.json", previousRunJson, 0666)
+	return deps
 }
 
 func indexJsonContains(index []indexLibrary, name, version string) int {
@@ -488,32 +918,87 @@ func indexJsonContains(index []indexLibrary, name, version string) int {
 	return -1
 }
 
-func includeHeadersFromLibraryFolder(library *types.Library) string {
+// How the header included by the generated sketch was picked
+const HEADER_MATCHED = "matched"
+const HEADER_FALLBACK = "fallback"
+const HEADER_NONE = "none"
+
+// includeHeadersFromLibraryFolder returns the include line of the header
+// whose name best matches the library, else of the first header found, and
+// which of the two (or none) it was
+func includeHeadersFromLibraryFolder(library *types.Library) (string, string) {
 	headers, _ := findFilesInFolder(library.Folder, ".h", false)
 	if len(headers) == 0 {
 		// no file in base dir, search src folder
 		headers, _ = findFilesInFolder(library.SrcFolder, ".h", false)
 	}
 	if len(headers) == 0 {
-		// no file in src folder either, search recursively (and probably fail)
-		headers, _ = findFilesInFolder(library.Folder, ".h", true)
+		// no file in src folder either, search recursively (and probably
+		// fail), down to -header-scan-depth levels
+		depth := *headerScanDepthFlag
+		if depth <= 0 {
+			depth = -1
+		}
+		headers, _ = findFilesInFolderToDepth(library.Folder, ".h", depth)
 	}
 	temp := "\n"
-	includedLibs := 0
+	bestHeader := ""
+	bestScore := HEADER_MATCH_THRESHOLD
 	for _, header := range headers {
-		if textdistance.JaroWinklerDistance(filepath.Base(header), library.Name) > 0.9 {
-			temp += "#include <" + filepath.Base(header) + ">\n"
-			includedLibs += 1
-			break
+		if score := headerMatchScore(header, library.Name); score > bestScore {
+			bestHeader = header
+			bestScore = score
 		}
 	}
-	if includedLibs == 0 && len(headers) > 0 {
-		temp += "#include <" + filepath.Base(headers[0]) + ">\n"
+	if bestHeader != "" {
+		return temp + "#include <" + filepath.Base(bestHeader) + ">\n", HEADER_MATCHED
+	} else if len(headers) > 0 {
+		return temp + "#include <" + filepath.Base(headers[0]) + ">\n", HEADER_FALLBACK
+	}
+	return temp, HEADER_NONE
+}
+
+// A header is included in the generated sketch if its name scores more than
+// HEADER_MATCH_THRESHOLD against the library name (the best one wins).
+// The score is the Jaro-Winkler similarity, but for names up to
+// SHORT_NAME_LENGTH characters, where its prefix bonus is misleading (SD vs
+// SdFat.h), it is blended with a normalized Levenshtein similarity between
+// the header name without extension and the library name, ignoring case.
+const HEADER_MATCH_THRESHOLD = 0.9
+const SHORT_NAME_LENGTH = 4
+const SHORT_NAME_LEVENSHTEIN_WEIGHT = 0.5
+
+func headerMatchScore(header string, name string) float64 {
+	base := filepath.Base(header)
+	score := textdistance.JaroWinklerDistance(base, name)
+	if len(name) > SHORT_NAME_LENGTH {
+		return score
+	}
+
+	stem := strings.ToLower(strings.TrimSuffix(base, filepath.Ext(base)))
+	lowerName := strings.ToLower(name)
+	longest := len(stem)
+	if len(lowerName) > longest {
+		longest = len(lowerName)
+	}
+	if longest == 0 {
+		return score
 	}
-	return temp
+	similarity := 1 - float64(textdistance.LevenshteinDistance(stem, lowerName))/float64(longest)
+	return (1-SHORT_NAME_LEVENSHTEIN_WEIGHT)*score + SHORT_NAME_LEVENSHTEIN_WEIGHT*similarity
 }
 
 func findFilesInFolder(sourcePath string, extension string, recurse bool) ([]string, error) {
+	depth := 0
+	if recurse {
+		depth = -1
+	}
+	return findFilesInFolderToDepth(sourcePath, extension, depth)
+}
+
+// findFilesInFolderToDepth also searches the subfolders of sourcePath, down
+// to depth levels below it; a negative depth means no limit
+func findFilesInFolderToDepth(sourcePath string, extension string, depth int) ([]string, error) {
 	files, err := utils.ReadDirFiltered(sourcePath, utils.FilterFilesWithExtensions(extension))
 	if err != nil {
 		return nil, i18n.WrapError(err)
@@ -523,14 +1008,14 @@ func findFilesInFolder(sourcePath string, extension string, recurse bool) ([]str
 		sources = append(sources, filepath.Join(sourcePath, file.Name()))
 	}
 
-	if recurse {
+	if depth != 0 {
 		folders, err := utils.ReadDirFiltered(sourcePath, utils.FilterDirs)
 		if err != nil {
 			return nil, i18n.WrapError(err)
 		}
 
 		for _, folder := range folders {
-			otherSources, err := findFilesInFolder(filepath.Join(sourcePath, folder.Name()), extension, recurse)
+			otherSources, err := findFilesInFolderToDepth(filepath.Join(sourcePath, folder.Name()), extension, depth-1)
 			if err != nil {
 				return nil, i18n.WrapError(err)
 			}
@@ -550,6 +1035,40 @@ func toExitCode(err error) int {
 	return 1
 }
 
+// isFlagSet tells if a flag was given on the command line, as opposed to
+// having its default value
+func isFlagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+// ideVersionToAPIVersion turns an IDE version like 1.8.0 in the number the
+// preprocessor gets as ARDUINO, like 10800
+func ideVersionToAPIVersion(ideVersion string) (string, error) {
+	parts := strings.Split(strings.TrimSpace(ideVersion), ".")
+	if len(parts) < 2 || len(parts) > 3 {
+		return "", errors.New("Parameter '" + FLAG_IDE_VERSION + "' must be a version like 1.8.0, got '" + ideVersion + "'")
+	}
+	apiVersion := 0
+	for i := 0; i < 3; i++ {
+		number := 0
+		if i < len(parts) {
+			var err error
+			number, err = strconv.Atoi(parts[i])
+			if err != nil || number < 0 || (i > 0 && number > 99) {
+				return "", errors.New("Parameter '" + FLAG_IDE_VERSION + "' must be a version like 1.8.0, got '" + ideVersion + "'")
+			}
+		}
+		apiVersion = apiVersion*100 + number
+	}
+	return strconv.Itoa(apiVersion), nil
+}
+
 func toSliceOfUnquoted(value []string) ([]string, error) {
 	var values []string
 	for _, v := range value {
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"arduino.cc/builder/types"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHeaderMatchScoreShortNames(t *testing.T) {
+	require.True(t, headerMatchScore("SD.h", "SD") > HEADER_MATCH_THRESHOLD)
+	require.True(t, headerMatchScore("SdFat.h", "SD") < HEADER_MATCH_THRESHOLD)
+	require.True(t, headerMatchScore("FatFile.h", "SD") < HEADER_MATCH_THRESHOLD)
+	require.True(t, headerMatchScore("IRremote.h", "IR") < headerMatchScore("IR.h", "IR"))
+}
+
+func TestIncludeHeadersFromLibraryFolderShortName(t *testing.T) {
+	folder := filepath.Join("testdata", "libraries", "SD")
+	library := &types.Library{Name: "SD", Folder: folder, SrcFolder: filepath.Join(folder, "src")}
+
+	include, match := includeHeadersFromLibraryFolder(library)
+	require.Equal(t, "\n#include <SD.h>\n", include)
+	require.Equal(t, HEADER_MATCHED, match)
+}
+
+func TestIncludeHeadersFromLibraryFolderFallback(t *testing.T) {
+	folder := filepath.Join("testdata", "libraries", "SD")
+	library := &types.Library{Name: "Logger", Folder: folder, SrcFolder: filepath.Join(folder, "src")}
+
+	include, match := includeHeadersFromLibraryFolder(library)
+	require.Equal(t, "\n#include <FatFile.h>\n", include)
+	require.Equal(t, HEADER_FALLBACK, match)
+}
+
+func TestIdeVersionToAPIVersion(t *testing.T) {
+	version, err := ideVersionToAPIVersion("1.8.0")
+	require.NoError(t, err)
+	require.Equal(t, "10800", version)
+
+	version, err = ideVersionToAPIVersion("1.6.13")
+	require.NoError(t, err)
+	require.Equal(t, "10613", version)
+
+	_, err = ideVersionToAPIVersion("1.8.x")
+	require.Error(t, err)
+}
+
+func TestIncludeHeadersFromLibraryFolderDepth(t *testing.T) {
+	folder, err := ioutil.TempDir("", "header_depth")
+	require.NoError(t, err)
+	defer os.RemoveAll(folder)
+	require.NoError(t, os.MkdirAll(filepath.Join(folder, "vendor", "deep", "tree"), 0755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(folder, "vendor", "deep", "tree", "Deep.h"), []byte(""), 0666))
+	library := &types.Library{Name: "Deep", Folder: folder, SrcFolder: filepath.Join(folder, "src")}
+
+	defer func(original int) { *headerScanDepthFlag = original }(*headerScanDepthFlag)
+	*headerScanDepthFlag = 2
+	_, match := includeHeadersFromLibraryFolder(library)
+	require.Equal(t, HEADER_NONE, match)
+
+	*headerScanDepthFlag = 3
+	include, _ := includeHeadersFromLibraryFolder(library)
+	require.Equal(t, "\n#include <Deep.h>\n", include)
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// Summary of what a run wrote, exported with -manifest-out
+type runManifest struct {
+	Index         string `json:"index"`
+	IndexSize     int64  `json:"indexSize"`
+	IndexChecksum string `json:"indexChecksum"`
+	Cache         string `json:"cache,omitempty"`
+
+	Analyzed int `json:"analyzed"`
+	Failed   int `json:"failed"`
+	Skipped  int `json:"skipped"`
+}
+
+// buildManifest describes the index written at indexPath and the outcome of
+// the run
+func buildManifest(indexPath string, cachePath string, analyzed int, stats *runStats) (*runManifest, error) {
+	info, err := os.Stat(indexPath)
+	if err != nil {
+		return nil, err
+	}
+	checksum, err := fileChecksum(indexPath, *checksumAlgoFlag)
+	if err != nil {
+		return nil, err
+	}
+	if absPath, err := filepath.Abs(indexPath); err == nil {
+		indexPath = absPath
+	}
+	if cachePath != "" {
+		if absPath, err := filepath.Abs(cachePath); err == nil {
+			cachePath = absPath
+		}
+	}
+	return &runManifest{
+		Index:         indexPath,
+		IndexSize:     info.Size(),
+		IndexChecksum: checksum,
+		Cache:         cachePath,
+		Analyzed:      analyzed,
+		Failed:        len(stats.Failed),
+		Skipped:       len(stats.Skipped),
+	}, nil
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildManifest(t *testing.T) {
+	folder, err := ioutil.TempDir("", "manifest")
+	require.NoError(t, err)
+	defer os.RemoveAll(folder)
+	indexPath := filepath.Join(folder, "library_index.json")
+	require.NoError(t, ioutil.WriteFile(indexPath, []byte("abc"), 0666))
+
+	stats := &runStats{
+		Failed:  []indexEntryRef{{Name: "Broken", Version: "1.0.0"}},
+		Skipped: []skippedLibrary{{Name: "Cached", Version: "1.0.0"}, {Name: "Other", Version: "1.0.0"}},
+	}
+	manifest, err := buildManifest(indexPath, "", 5, stats)
+	require.NoError(t, err)
+	require.Equal(t, &runManifest{
+		Index:         indexPath,
+		IndexSize:     3,
+		IndexChecksum: "SHA-256:ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad",
+		Analyzed:      5,
+		Failed:        1,
+		Skipped:       2,
+	}, manifest)
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+var emailRegexp = regexp.MustCompile(`[<(\[]*\s*([^\s<>()\[\],]+@[^\s<>()\[\],]+)\s*[>)\]]*`)
+
+// normalizePeople rewrites a comma separated list of authors or maintainers
+// so that every entry looks like "Name <email>": whitespace is collapsed and
+// emails, however they were bracketed, get a single pair of angle brackets.
+func normalizePeople(people string) string {
+	var normalized []string
+	for _, person := range strings.Split(people, ",") {
+		person = normalizePerson(person)
+		if person != "" {
+			normalized = append(normalized, person)
+		}
+	}
+	return strings.Join(normalized, ", ")
+}
+
+func normalizePerson(person string) string {
+	email := ""
+	if match := emailRegexp.FindStringSubmatch(person); match != nil {
+		email = match[1]
+		person = strings.Replace(person, match[0], " ", 1)
+	}
+	name := strings.Join(strings.Fields(person), " ")
+	if email == "" {
+		return name
+	}
+	return strings.TrimSpace(name + " <" + email + ">")
+}
+
+func normalizeMetadata(libraries []indexLibrary) {
+	for idx := range libraries {
+		libraries[idx].Author = normalizePeople(libraries[idx].Author)
+		libraries[idx].Maintainer = normalizePeople(libraries[idx].Maintainer)
+	}
+}
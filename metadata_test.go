@@ -0,0 +1,17 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizePeople(t *testing.T) {
+	require.Equal(t, "John Doe", normalizePeople("  John   Doe "))
+	require.Equal(t, "John Doe <john@x.com>", normalizePeople("John Doe <john@x.com>"))
+	require.Equal(t, "John Doe <john@x.com>", normalizePeople("John Doe <<john@x.com>>"))
+	require.Equal(t, "John Doe <john@x.com>", normalizePeople("John Doe (john@x.com)"))
+	require.Equal(t, "John Doe <john@x.com>", normalizePeople("John Doe john@x.com"))
+	require.Equal(t, "<john@x.com>", normalizePeople("john@x.com"))
+	require.Equal(t, "John Doe <john@x.com>, Jane Roe", normalizePeople("John Doe<john@x.com> ,Jane  Roe,"))
+}
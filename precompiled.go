@@ -0,0 +1,34 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"arduino.cc/builder/types"
+)
+
+const LIBRARY_PRECOMPILED = "precompiled"
+
+// isPrecompiled tells if a library ships its code as binaries, either by
+// declaring precompiled=true or by having .a archives in src/<arch>/. The
+// synthetic sketch can't tell anything useful about such libraries.
+func isPrecompiled(library *types.Library) bool {
+	if strings.TrimSpace(library.Properties[LIBRARY_PRECOMPILED]) == "true" {
+		return true
+	}
+	folders, err := ioutil.ReadDir(filepath.Join(library.Folder, "src"))
+	if err != nil {
+		return false
+	}
+	for _, folder := range folders {
+		if !folder.IsDir() {
+			continue
+		}
+		archives, _ := filepath.Glob(filepath.Join(library.Folder, "src", folder.Name(), "*.a"))
+		if len(archives) > 0 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+
+	"arduino.cc/builder/types"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsPrecompiled(t *testing.T) {
+	library := &types.Library{Folder: filepath.Join("testdata", "libraries", "Precompiled")}
+	require.True(t, isPrecompiled(library))
+
+	library = &types.Library{Folder: filepath.Join("testdata", "libraries", "SD")}
+	require.False(t, isPrecompiled(library))
+
+	library.Properties = map[string]string{LIBRARY_PRECOMPILED: "true"}
+	require.True(t, isPrecompiled(library))
+}
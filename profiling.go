@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	_ "net/http/pprof"
+	"os"
+	"runtime"
+	"runtime/pprof"
+)
+
+// startProfiling sets up what was asked by -pprof, -cpuprofile and
+// -memprofile, and returns the function writing the profiles when the run
+// is over
+func startProfiling() (func(), error) {
+	if *pprofFlag != "" {
+		go func() {
+			fmt.Println(http.ListenAndServe(*pprofFlag, nil))
+		}()
+	}
+
+	var cpuProfile *os.File
+	if *cpuProfileFlag != "" {
+		var err error
+		cpuProfile, err = os.Create(*cpuProfileFlag)
+		if err != nil {
+			return nil, err
+		}
+		if err := pprof.StartCPUProfile(cpuProfile); err != nil {
+			cpuProfile.Close()
+			return nil, err
+		}
+	}
+
+	return func() {
+		if cpuProfile != nil {
+			pprof.StopCPUProfile()
+			cpuProfile.Close()
+		}
+		if *memProfileFlag != "" {
+			memProfile, err := os.Create(*memProfileFlag)
+			if err != nil {
+				fmt.Println(err.Error())
+				return
+			}
+			defer memProfile.Close()
+			runtime.GC()
+			if err := pprof.WriteHeapProfile(memProfile); err != nil {
+				fmt.Println(err.Error())
+			}
+		}
+	}, nil
+}
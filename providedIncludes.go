@@ -0,0 +1,69 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"arduino.cc/builder/types"
+	"arduino.cc/builder/utils"
+)
+
+var headerExtensions = []string{".h", ".hpp", ".hh"}
+
+// Folders of a library without src/ which are never part of its sources
+var nonSourceFolders = []string{"examples", "extras"}
+
+// providedIncludes lists, sorted, the headers a sketch can include from a
+// library, as they would be written in the #include line
+func providedIncludes(library *types.Library) ([]string, error) {
+	root := library.SrcFolder
+	if root == "" {
+		root = library.Folder
+	}
+	var includes []string
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == root {
+			return nil
+		}
+		if info.IsDir() {
+			if utils.IsSCCSOrHiddenFile(info) || (filepath.Dir(path) == library.Folder && sliceContainsFold(nonSourceFolders, info.Name())) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if utils.IsSCCSOrHiddenFile(info) || !sliceContainsFold(headerExtensions, filepath.Ext(path)) {
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		includes = append(includes, filepath.ToSlash(rel))
+		return nil
+	})
+	sort.Strings(includes)
+	return includes, err
+}
+
+// probeIncludes maps every library to the headers it provides. Libraries
+// sharing a name are merged.
+func probeIncludes(libraries []*types.Library) (map[string][]string, error) {
+	probed := make(map[string][]string)
+	for _, library := range libraries {
+		includes, err := providedIncludes(library)
+		if err != nil {
+			return nil, err
+		}
+		name := library.RealName
+		if strings.TrimSpace(name) == "" {
+			name = library.Name
+		}
+		probed[name] = mergeDependencies(probed[name], includes)
+	}
+	return probed, nil
+}
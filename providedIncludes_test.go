@@ -0,0 +1,33 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"arduino.cc/builder/types"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestProbeIncludes(t *testing.T) {
+	flat, err := ioutil.TempDir("", "Flat")
+	require.NoError(t, err)
+	defer os.RemoveAll(flat)
+	for _, file := range []string{"Flat.h", "Flat.cpp", "utility/w5100.h", "examples/Basic/config.h", ".hidden/secret.h"} {
+		require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(flat, file)), 0755))
+		require.NoError(t, ioutil.WriteFile(filepath.Join(flat, file), []byte{}, 0666))
+	}
+
+	sd := filepath.Join("testdata", "libraries", "SD")
+	probed, err := probeIncludes([]*types.Library{
+		{Name: "SD", RealName: "SD", Folder: sd, SrcFolder: filepath.Join(sd, "src")},
+		{Name: "Flat", Folder: flat, SrcFolder: flat},
+	})
+	require.NoError(t, err)
+	require.Equal(t, map[string][]string{
+		"SD":   {"FatFile.h", "SD.h", "SdFat.h"},
+		"Flat": {"Flat.h", "utility/w5100.h"},
+	}, probed)
+}
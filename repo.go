@@ -0,0 +1,75 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"arduino.cc/builder/constants"
+	"arduino.cc/builder/i18n"
+	"arduino.cc/builder/types"
+	"arduino.cc/properties"
+)
+
+// library.properties key listing the libraries a library needs
+const LIBRARY_DEPENDS = "depends"
+
+// installRepo copies the library checked out in repo to a new temporary
+// libraries folder, in a folder named after the library like the library
+// manager would do, and returns the copy. The .git folder and the other
+// hidden files are left out.
+func installRepo(repo string) (string, error) {
+	libProperties, err := properties.Load(filepath.Join(repo, constants.LIBRARY_PROPERTIES), i18n.NoopLogger{})
+	if err != nil {
+		return "", err
+	}
+	name := strings.TrimSpace(libProperties[constants.LIBRARY_NAME])
+	if name == "" {
+		return "", errors.New("no library name in " + filepath.Join(repo, constants.LIBRARY_PROPERTIES))
+	}
+
+	librariesFolder, err := ioutil.TempDir("", "repo_libraries")
+	if err != nil {
+		return "", err
+	}
+	folder := filepath.Join(librariesFolder, realNameFolder(&types.Library{RealName: name}))
+	if err := copyFolder(repo, folder); err != nil {
+		os.RemoveAll(librariesFolder)
+		return "", err
+	}
+	return folder, nil
+}
+
+// parseDepends returns the library names listed in the 'depends' property of
+// a library, without their version constraints
+func parseDepends(depends string) []string {
+	var names []string
+	for _, dep := range splitList(depends) {
+		if paren := strings.Index(dep, "("); paren != -1 {
+			dep = strings.TrimSpace(dep[:paren])
+		}
+		if dep != "" {
+			names = append(names, dep)
+		}
+	}
+	return names
+}
+
+// checkDeclaredDepends compares the 'depends' declared by a library with
+// the dependencies found, warning about any difference
+func checkDeclaredDepends(library *types.Library, found []string) {
+	declared := parseDepends(library.Properties[LIBRARY_DEPENDS])
+	missing := withoutDependencies(found, declared)
+	unused := withoutDependencies(declared, found)
+	for _, dep := range missing {
+		fmt.Println("Warning: " + library.RealName + " depends on " + dep + ", which is not declared in 'depends'")
+	}
+	for _, dep := range unused {
+		fmt.Println("Warning: " + library.RealName + " declares " + dep + " in 'depends', but doesn't use it")
+	}
+	warnings.add(WARNING_UNDECLARED_DEPENDENCY, len(missing))
+	warnings.add(WARNING_UNUSED_DEPENDENCY, len(unused))
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestInstallRepo(t *testing.T) {
+	repo, err := ioutil.TempDir("", "repo")
+	require.NoError(t, err)
+	defer os.RemoveAll(repo)
+	require.NoError(t, copyFolder(filepath.Join("testdata", "repos", "Weather"), repo))
+	require.NoError(t, os.Mkdir(filepath.Join(repo, ".git"), 0755))
+
+	folder, err := installRepo(repo)
+	require.NoError(t, err)
+	defer os.RemoveAll(filepath.Dir(folder))
+
+	require.Equal(t, "Weather_Station", filepath.Base(folder))
+	_, err = os.Stat(filepath.Join(folder, "src", "Weather.h"))
+	require.NoError(t, err)
+	_, err = os.Stat(filepath.Join(folder, ".git"))
+	require.True(t, os.IsNotExist(err))
+
+	_, err = installRepo(filepath.Join("testdata", "libraries", "NoExamples"))
+	require.Error(t, err)
+}
+
+func TestParseDepends(t *testing.T) {
+	require.Equal(t, []string{"Adafruit Unified Sensor", "SD"}, parseDepends("Adafruit Unified Sensor (>=1.0.0), SD"))
+	require.Empty(t, parseDepends(""))
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"arduino.cc/builder/types"
+)
+
+const CACHED_RESULTS_FILE = "cached_results.json"
+
+// analyzedCacheKey is the key of a library in the cache of analyzed
+// libraries: the same library analyzed for another board is not a cache hit
+func analyzedCacheKey(name, fqbn string) string {
+	return name + "@" + fqbn
+}
+
+// migrateCacheKeys rewrites the keys of a cache written before it was keyed
+// by board: a bare library name becomes the key of the FQBN the library
+// resolves to now, a name no installed library has is dropped. It returns
+// how many keys were migrated and how many dropped
+func migrateCacheKeys(exists map[string]bool, libraries []*types.Library) (int, int) {
+	migrated, dropped := 0, 0
+	for key, analyzed := range exists {
+		if strings.Contains(key, "@") {
+			continue
+		}
+		delete(exists, key)
+		library := findLibraryByName(libraries, key)
+		if library == nil {
+			dropped++
+			continue
+		}
+		fqbn, _ := resolveFQBN(library.Name, libraryArchs(library))
+		exists[analyzedCacheKey(library.Name, fqbn)] = analyzed
+		migrated++
+	}
+	return migrated, dropped
+}
+
+// findLibraryByName returns the installed library with the given name, nil
+// if there is none
+func findLibraryByName(libraries []*types.Library, name string) *types.Library {
+	for _, library := range libraries {
+		if library.Name == name {
+			return library
+		}
+	}
+	return nil
+}
+
+// failedCacheKey is the key of a library in the failures kept in the cache
+func failedCacheKey(name, version string) string {
+	return name + "@" + version
+}
+
+// isURL tells if the -json index is remote
+func isURL(path string) bool {
+	return strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://")
+}
+
+// indexOutputPath is where the analyzed index gets written: a remote index
+// can't be overwritten, so -output is mandatory for it
+func indexOutputPath() string {
+	if *outputFlag != "" {
+		return *outputFlag
+	}
+	return *librariesJsonPath
+}
+
+// loadIndex reads the library index at path, which can be an http(s) url
+// too. Gzipped indexes are recognized from their contents.
+func loadIndex(path string, timeout time.Duration) (indexOutput, error) {
+	index, err := readIndex(path, timeout)
+	if err != nil {
+		return index, errors.New("cannot read index file " + path + ": " + err.Error())
+	}
+	stripConstraints(index.Libraries)
+	restoreDirectRequires(index.Libraries)
+	return index, nil
+}
+
+func readIndex(path string, timeout time.Duration) (indexOutput, error) {
+	var index indexOutput
+	err := withIndexReader(path, timeout, func(r io.Reader) error {
+		var err error
+		index, err = decodeIndex(r)
+		return err
+	})
+	return index, err
+}
+
+// withIndexReader opens the index at path, a file or an http(s) url,
+// gunzipping it if needed, and passes its contents to read
+func withIndexReader(path string, timeout time.Duration, read func(io.Reader) error) error {
+	var body io.ReadCloser
+	if isURL(path) {
+		client := &http.Client{Timeout: timeout}
+		response, err := client.Get(path)
+		if err != nil {
+			return err
+		}
+		if response.StatusCode != http.StatusOK {
+			response.Body.Close()
+			return errors.New(response.Status)
+		}
+		body = response.Body
+	} else {
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		body = file
+	}
+	defer body.Close()
+
+	reader := bufio.NewReader(body)
+	if magic, err := reader.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gzipReader, err := gzip.NewReader(reader)
+		if err != nil {
+			return err
+		}
+		defer gzipReader.Close()
+		return read(gzipReader)
+	}
+	return read(reader)
+}
+
+// decodeIndex decodes a library index one library at a time, straight from
+// r: the raw json is never buffered as a whole, only the decoded libraries
+// are kept. Keys other than 'libraries' are ignored.
+func decodeIndex(r io.Reader) (indexOutput, error) {
+	var index indexOutput
+	dec := json.NewDecoder(r)
+	if err := expectDelim(dec, '{'); err != nil {
+		return index, err
+	}
+	for dec.More() {
+		token, err := dec.Token()
+		if err != nil {
+			return index, err
+		}
+		if token != "libraries" {
+			var skipped json.RawMessage
+			if err := dec.Decode(&skipped); err != nil {
+				return index, err
+			}
+			continue
+		}
+		if err := expectDelim(dec, '['); err != nil {
+			return index, err
+		}
+		for dec.More() {
+			var entry indexEntry
+			if err := dec.Decode(&entry); err != nil {
+				return index, err
+			}
+			index.Libraries = append(index.Libraries, entry.library())
+		}
+		if err := expectDelim(dec, ']'); err != nil {
+			return index, err
+		}
+	}
+	return index, expectDelim(dec, '}')
+}
+
+func expectDelim(dec *json.Decoder, delim json.Delim) error {
+	token, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if token != delim {
+		return errors.New("malformed library index: expected '" + delim.String() + "', got " + fmt.Sprint(token))
+	}
+	return nil
+}
+
+// writeFileAtomically writes data to a temporary file next to path, then
+// renames it over path: a crash never leaves a half written file behind
+func writeFileAtomically(path string, data []byte) error {
+	temp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path))
+	if err != nil {
+		return err
+	}
+	_, err = temp.Write(data)
+	if err == nil {
+		err = temp.Sync()
+	}
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(temp.Name(), 0666)
+	}
+	if err == nil {
+		err = os.Rename(temp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(temp.Name())
+	}
+	return err
+}
+
+func writeJsonAtomically(path string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "    ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomically(path, data)
+}
+
+// sortedIndex returns a copy of the index with the libraries sorted by name,
+// case insensitively, then by version. The index itself is left alone, as
+// the analysis refers to its entries by position.
+func sortedIndex(indexJson *indexOutput) *indexOutput {
+	libraries := append([]indexLibrary{}, indexJson.Libraries...)
+	sort.SliceStable(libraries, func(i, j int) bool {
+		nameI, nameJ := strings.ToLower(libraries[i].LibraryName), strings.ToLower(libraries[j].LibraryName)
+		if nameI != nameJ {
+			return nameI < nameJ
+		}
+		return compareVersions(libraries[i].Version, libraries[j].Version) < 0
+	})
+	return &indexOutput{Libraries: libraries}
+}
+
+// compareVersions compares two dotted versions part by part, numerically
+// when both parts are numbers, and returns -1, 0 or 1
+func compareVersions(a, b string) int {
+	partsA, partsB := strings.Split(a, "."), strings.Split(b, ".")
+	for idx := 0; idx < len(partsA) && idx < len(partsB); idx++ {
+		numA, errA := strconv.Atoi(partsA[idx])
+		numB, errB := strconv.Atoi(partsB[idx])
+		switch {
+		case errA == nil && errB == nil && numA != numB:
+			if numA < numB {
+				return -1
+			}
+			return 1
+		case (errA != nil || errB != nil) && partsA[idx] != partsB[idx]:
+			if partsA[idx] < partsB[idx] {
+				return -1
+			}
+			return 1
+		}
+	}
+	switch {
+	case len(partsA) < len(partsB):
+		return -1
+	case len(partsA) > len(partsB):
+		return 1
+	}
+	return 0
+}
+
+// saveResults writes the index and the cache of analyzed libraries
+func saveResults(indexJson *indexOutput, previousRun *indexLibrariesAnalyzed) {
+	if indexOutputPath() != "" {
+		indexJson = expandedIndex(indexJson, *dependencyDepthFlag)
+		if *sortOutputFlag {
+			indexJson = sortedIndex(indexJson)
+		}
+		if *dependencyFormatFlag == DEPENDENCY_FORMAT_CONSTRAINED {
+			indexJson = constrainedIndex(indexJson)
+		}
+		err := writeJsonAtomically(indexOutputPath(), indexInSchema(indexJson, *schemaFlag))
+		if err != nil {
+			fmt.Println(err.Error())
+		}
+	}
+	if *libraryPathFlag == "" {
+		err := writeJsonAtomically(CACHED_RESULTS_FILE, previousRun)
+		if err != nil {
+			fmt.Println(err.Error())
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"arduino.cc/builder/types"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeIndex(t *testing.T) {
+	index, err := decodeIndex(strings.NewReader(`{
+		"comment": {"generated": "today"},
+		"libraries": [
+			{"name": "SD", "version": "1.2.2", "requires": ["SPI"]},
+			{"name": "Servo", "version": "1.1.2"}
+		]
+	}`))
+	require.NoError(t, err)
+	require.Equal(t, []indexLibrary{
+		{LibraryName: "SD", Version: "1.2.2", Requires: []string{"SPI"}},
+		{LibraryName: "Servo", Version: "1.1.2"},
+	}, index.Libraries)
+
+	_, err = decodeIndex(strings.NewReader(`{"libraries": {"name": "SD"}}`))
+	require.Error(t, err)
+}
+
+func TestLoadIndexFromGzippedURL(t *testing.T) {
+	var gzipped bytes.Buffer
+	writer := gzip.NewWriter(&gzipped)
+	writer.Write([]byte(`{"libraries": [{"name": "SD", "version": "1.2.2"}]}`))
+	require.NoError(t, writer.Close())
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/library_index.json.gz" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(gzipped.Bytes())
+	}))
+	defer server.Close()
+
+	index, err := loadIndex(server.URL+"/library_index.json.gz", 10*time.Second)
+	require.NoError(t, err)
+	require.Equal(t, []indexLibrary{{LibraryName: "SD", Version: "1.2.2"}}, index.Libraries)
+
+	_, err = loadIndex(server.URL+"/missing.json", 10*time.Second)
+	require.EqualError(t, err, "cannot read index file "+server.URL+"/missing.json: 404 Not Found")
+}
+
+func TestLoadIndexMissingFile(t *testing.T) {
+	_, err := loadIndex(filepath.Join("testdata", "missing.json"), time.Second)
+	require.Error(t, err)
+	require.True(t, strings.HasPrefix(err.Error(), "cannot read index file "+filepath.Join("testdata", "missing.json")+": "))
+}
+
+func TestSortedIndex(t *testing.T) {
+	index := &indexOutput{Libraries: []indexLibrary{
+		{LibraryName: "Servo", Version: "1.10.0"},
+		{LibraryName: "SD", Version: "1.2.2"},
+		{LibraryName: "Servo", Version: "1.9.0"},
+		{LibraryName: "adafruit GFX", Version: "1.0.0"},
+	}}
+
+	sorted := sortedIndex(index)
+	var order []string
+	for _, lib := range sorted.Libraries {
+		order = append(order, lib.LibraryName+" "+lib.Version)
+	}
+	require.Equal(t, []string{"adafruit GFX 1.0.0", "SD 1.2.2", "Servo 1.9.0", "Servo 1.10.0"}, order)
+	require.Equal(t, "Servo", index.Libraries[0].LibraryName)
+}
+
+func TestCompareVersions(t *testing.T) {
+	require.Equal(t, -1, compareVersions("1.9.0", "1.10.0"))
+	require.Equal(t, 1, compareVersions("2.0", "1.99.99"))
+	require.Equal(t, 0, compareVersions("1.0.0", "1.0.0"))
+	require.Equal(t, -1, compareVersions("1.0", "1.0.1"))
+	require.Equal(t, -1, compareVersions("1.0.0-beta", "1.0.0-rc"))
+}
+
+func TestMigrateCacheKeys(t *testing.T) {
+	libraries := []*types.Library{
+		{Name: "Servo", Archs: []string{"avr"}},
+		{Name: "Robot_Control", Archs: []string{"avr"}},
+	}
+	exists := map[string]bool{
+		"Servo":                         true,
+		"Removed":                       true,
+		"Robot_Control@arduino:avr:yun": true,
+	}
+
+	migrated, dropped := migrateCacheKeys(exists, libraries)
+	require.Equal(t, 1, migrated)
+	require.Equal(t, 1, dropped)
+
+	fqbn, _ := resolveFQBN("Servo", []string{"avr"})
+	require.Equal(t, map[string]bool{
+		analyzedCacheKey("Servo", fqbn): true,
+		"Robot_Control@arduino:avr:yun": true,
+	}, exists)
+}
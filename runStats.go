@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+)
+
+// Statistics collected during a run, exported with -stats-out
+type runStats struct {
+	Unmatched []indexEntryRef  `json:"unmatched,omitempty"`
+	Failed    []indexEntryRef  `json:"failed,omitempty"`
+	Skipped   []skippedLibrary `json:"skipped,omitempty"`
+
+	DepsDeltaExceeded []indexEntryRef `json:"depsDeltaExceeded,omitempty"`
+	// libraries compiled for DEFAULT_FQBN, since no board matched them
+	FQBNFallback []indexEntryRef `json:"fqbnFallback,omitempty"`
+
+	// how many hops of transitive dependencies were added to 'requires'
+	DependencyDepth int `json:"dependencyDepth"`
+
+	// how many libraries use every dependency provided by cores or builtin
+	// folders
+	InternalDeps map[string]int `json:"internalDeps,omitempty"`
+
+	// how many generated sketches included a header matched by name, the
+	// first header as a fallback or no header at all
+	HeaderMatches map[string]int `json:"headerMatches,omitempty"`
+}
+
+type indexEntryRef struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// collectUnmatched returns the index entries that were never paired with an
+// installed library, so they could not be analyzed.
+func collectUnmatched(index []indexLibrary, matched []bool) []indexEntryRef {
+	var unmatched []indexEntryRef
+	for idx, lib := range index {
+		if !matched[idx] {
+			unmatched = append(unmatched, indexEntryRef{Name: lib.LibraryName, Version: lib.Version})
+		}
+	}
+	return unmatched
+}
+
+func printUnmatched(unmatched []indexEntryRef) {
+	if len(unmatched) == 0 {
+		return
+	}
+	fmt.Println("Warning: " + fmt.Sprint(len(unmatched)) + " libraries in the index don't match any installed library and were not analyzed:")
+	for _, ref := range unmatched {
+		fmt.Println("  " + ref.Name + " " + ref.Version)
+	}
+}
+
+func writeStats(path string, stats *runStats) error {
+	data, err := json.MarshalIndent(stats, "", "    ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0666)
+}
+
+// countInternalDeps records the dependencies provided by cores or builtin
+// folders found for a library
+func (stats *runStats) countInternalDeps(internalDeps []string) {
+	if stats.InternalDeps == nil {
+		stats.InternalDeps = make(map[string]int)
+	}
+	for _, dep := range internalDeps {
+		stats.InternalDeps[dep]++
+	}
+}
+
+func (stats *runStats) countHeaderMatch(match string) {
+	if stats.HeaderMatches == nil {
+		stats.HeaderMatches = make(map[string]int)
+	}
+	stats.HeaderMatches[match]++
+}
+
+type dependencyFrequency struct {
+	Name      string
+	Libraries int
+}
+
+// rankFrequencies sorts the dependencies by how many libraries use them, the
+// most used first, then by name
+func rankFrequencies(frequencies map[string]int) []dependencyFrequency {
+	var ranking []dependencyFrequency
+	for name, libraries := range frequencies {
+		ranking = append(ranking, dependencyFrequency{Name: name, Libraries: libraries})
+	}
+	sort.Slice(ranking, func(i, j int) bool {
+		if ranking[i].Libraries != ranking[j].Libraries {
+			return ranking[i].Libraries > ranking[j].Libraries
+		}
+		return ranking[i].Name < ranking[j].Name
+	})
+	return ranking
+}
+
+func printInternalDeps(frequencies map[string]int) {
+	if len(frequencies) == 0 {
+		return
+	}
+	fmt.Println("Dependencies provided by cores or builtin, by number of libraries using them:")
+	for _, dep := range rankFrequencies(frequencies) {
+		fmt.Printf("%s, %d\n", dep.Name, dep.Libraries)
+	}
+}
+
+func printFQBNFallback(fallback []indexEntryRef) {
+	fmt.Println(fmt.Sprint(len(fallback)) + " libraries matched no board and were compiled for " + DEFAULT_FQBN + ":")
+	for _, ref := range fallback {
+		fmt.Println("  " + ref.Name + " " + ref.Version)
+	}
+}
+
+type skippedLibrary struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	Reason  string `json:"reason"`
+}
+
+func printSkipped(skipped []skippedLibrary) {
+	fmt.Println(fmt.Sprint(len(skipped)) + " libraries were not analyzed:")
+	for _, lib := range skipped {
+		fmt.Println("  " + lib.Name + " " + lib.Version + ": " + lib.Reason)
+	}
+}
+
+func printHeaderMatches(matches map[string]int) {
+	total := matches[HEADER_MATCHED] + matches[HEADER_FALLBACK]
+	if total == 0 {
+		return
+	}
+	fmt.Printf("Headers matched by name: %d, first header used instead: %d (%.1f%% fallbacks)\n", matches[HEADER_MATCHED], matches[HEADER_FALLBACK], 100*float64(matches[HEADER_FALLBACK])/float64(total))
+	if matches[HEADER_NONE] > 0 {
+		fmt.Printf("Libraries without any header: %d\n", matches[HEADER_NONE])
+	}
+}
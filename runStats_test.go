@@ -0,0 +1,21 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRankInternalDeps(t *testing.T) {
+	var stats runStats
+	stats.countInternalDeps([]string{"SPI", "Wire"})
+	stats.countInternalDeps([]string{"Wire"})
+	stats.countInternalDeps([]string{"EEPROM", "SPI", "Wire"})
+	stats.countInternalDeps(nil)
+
+	require.Equal(t, []dependencyFrequency{
+		{Name: "Wire", Libraries: 3},
+		{Name: "SPI", Libraries: 2},
+		{Name: "EEPROM", Libraries: 1},
+	}, rankFrequencies(stats.InternalDeps))
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"runtime/debug"
+
+	"arduino.cc/builder"
+	"arduino.cc/builder/types"
+)
+
+// runBuilder builds the sketch in ctx; replaced in tests
+var runBuilder = builder.RunBuilder
+
+// builderPanic is the error of a build during which the builder panicked
+type builderPanic struct {
+	value interface{}
+}
+
+func (p *builderPanic) Error() string {
+	return "builder panicked: " + fmt.Sprint(p.value)
+}
+
+// runBuilderSafely runs the builder, turning a panic into an error so that a
+// library the builder chokes on fails alone. The stack is printed with
+// -verbose.
+func runBuilderSafely(ctx *types.Context) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			if ctx.Verbose {
+				fmt.Println(string(debug.Stack()))
+			}
+			err = &builderPanic{value: r}
+		}
+	}()
+	return runBuilder(ctx)
+}
+
+// failureReason describes why a build failed
+func failureReason(err error, reason string) string {
+	if failure, ok := err.(*buildFailure); ok {
+		err = failure.err
+	}
+	if _, ok := err.(*builderPanic); ok {
+		return "failed (panic)"
+	}
+	return reason
+}
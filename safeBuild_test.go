@@ -0,0 +1,56 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"arduino.cc/builder/types"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunBuilderSafely(t *testing.T) {
+	defer func(original func(*types.Context) error) { runBuilder = original }(runBuilder)
+
+	runBuilder = func(ctx *types.Context) error { panic("malformed library") }
+	err := runBuilderSafely(&types.Context{})
+	require.Error(t, err)
+	require.Equal(t, "builder panicked: malformed library", err.Error())
+	require.Equal(t, "failed (panic)", failureReason(err, "sketch failed to compile"))
+	require.False(t, isTransientBuildError(err))
+
+	runBuilder = func(ctx *types.Context) error { return errors.New("exit status 1") }
+	err = runBuilderSafely(&types.Context{})
+	require.Equal(t, "sketch failed to compile", failureReason(err, "sketch failed to compile"))
+}
+
+func TestAnalysisSurvivesBuilderPanic(t *testing.T) {
+	defer func(original func(*types.Context) error) { runBuilder = original }(runBuilder)
+	builds := 0
+	runBuilder = func(ctx *types.Context) error {
+		builds++
+		panic("malformed library")
+	}
+
+	librariesFolder := filepath.Join("testdata", "libraries")
+	libraries := []*types.Library{
+		{Name: "TemplateOnly", RealName: "TemplateOnly", Version: "1.0.0", Folder: filepath.Join(librariesFolder, "TemplateOnly"), Archs: []string{"*"}},
+		{Name: "SD", RealName: "SD", Version: "1.2.2", Folder: filepath.Join(librariesFolder, "SD"), Archs: []string{"*"}},
+	}
+	index := indexOutput{Libraries: []indexLibrary{{LibraryName: "TemplateOnly", Version: "1.0.0"}, {LibraryName: "SD", Version: "1.2.2"}}}
+	previousRun := indexLibrariesAnalyzed{Exists: make(map[string]bool), Failed: make(map[string]bool)}
+	a := &analysis{
+		ctx:            &types.Context{OtherLibrariesFolders: []string{librariesFolder}},
+		indexJson:      &index,
+		previousRun:    &previousRun,
+		sketchTemplate: DEFAULT_SKETCH_TEMPLATE,
+		matched:        make([]bool, len(index.Libraries)),
+	}
+
+	require.NoError(t, a.analyzeLibraries(libraries, 1))
+	require.Equal(t, 2, a.analyzed)
+	require.True(t, builds >= 2)
+	require.Equal(t, []indexEntryRef{{Name: "TemplateOnly", Version: "1.0.0"}, {Name: "SD", Version: "1.2.2"}}, a.stats.Failed)
+	require.True(t, previousRun.Failed[failedCacheKey("SD", "1.2.2")])
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// readSinceFile reads the RFC3339 time written in path by the last run. A
+// missing file means there was no last run: the zero time is returned.
+func readSinceFile(path string) (time.Time, error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Parse(time.RFC3339, strings.TrimSpace(string(data)))
+}
+
+func writeSinceFile(path string, since time.Time) error {
+	return writeFileAtomically(path, []byte(since.Format(time.RFC3339)+"\n"))
+}
+
+// newestModTime returns the modification time of the most recently changed
+// file or folder in folder
+func newestModTime(folder string) (time.Time, error) {
+	var newest time.Time
+	err := filepath.Walk(folder, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.ModTime().After(newest) {
+			newest = info.ModTime()
+		}
+		return nil
+	})
+	return newest, err
+}
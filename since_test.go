@@ -0,0 +1,46 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSinceFile(t *testing.T) {
+	folder, err := ioutil.TempDir("", "since")
+	require.NoError(t, err)
+	defer os.RemoveAll(folder)
+	path := filepath.Join(folder, "last_run")
+
+	since, err := readSinceFile(path)
+	require.NoError(t, err)
+	require.True(t, since.IsZero())
+
+	lastRun := time.Date(2017, 6, 1, 12, 0, 0, 0, time.UTC)
+	require.NoError(t, writeSinceFile(path, lastRun))
+	since, err = readSinceFile(path)
+	require.NoError(t, err)
+	require.True(t, lastRun.Equal(since))
+}
+
+func TestNewestModTime(t *testing.T) {
+	folder, err := ioutil.TempDir("", "library")
+	require.NoError(t, err)
+	defer os.RemoveAll(folder)
+	require.NoError(t, copyFolder(filepath.Join("testdata", "libraries", "SD"), folder))
+
+	old := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+	changed := time.Date(2017, 6, 1, 0, 0, 0, 0, time.UTC)
+	require.NoError(t, filepath.Walk(folder, func(path string, info os.FileInfo, err error) error {
+		return os.Chtimes(path, old, old)
+	}))
+	require.NoError(t, os.Chtimes(filepath.Join(folder, "src", "SD.h"), changed, changed))
+
+	newest, err := newestModTime(folder)
+	require.NoError(t, err)
+	require.True(t, changed.Equal(newest))
+}
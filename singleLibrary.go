@@ -0,0 +1,39 @@
+package main
+
+import (
+	"path/filepath"
+
+	"arduino.cc/builder/types"
+)
+
+// findLibraryInFolder returns the loaded library living in folder, if any
+func findLibraryInFolder(libraries []*types.Library, folder string) *types.Library {
+	folder, err := filepath.Abs(folder)
+	if err != nil {
+		return nil
+	}
+	for _, library := range libraries {
+		libraryFolder, err := filepath.Abs(library.Folder)
+		if err == nil && libraryFolder == folder {
+			return library
+		}
+	}
+	return nil
+}
+
+// indexEntryFromLibrary describes a library like an entry of the index, for
+// -library-path where there's no index at all
+func indexEntryFromLibrary(library *types.Library) indexLibrary {
+	return indexLibrary{
+		LibraryName:   library.RealName,
+		Version:       library.Version,
+		Author:        library.Author,
+		Maintainer:    library.Maintainer,
+		License:       library.License,
+		Sentence:      library.Sentence,
+		Paragraph:     library.Paragraph,
+		Website:       library.URL,
+		Category:      library.Category,
+		Architectures: library.Archs,
+	}
+}
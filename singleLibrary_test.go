@@ -0,0 +1,27 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+
+	"arduino.cc/builder/types"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFindLibraryInFolder(t *testing.T) {
+	sd := &types.Library{RealName: "SD", Version: "1.2.2", Folder: filepath.Join("testdata", "libraries", "SD"), Archs: []string{"*"}}
+	libraries := []*types.Library{
+		{RealName: "TemplateOnly", Folder: filepath.Join("testdata", "libraries", "TemplateOnly")},
+		sd,
+	}
+
+	found := findLibraryInFolder(libraries, filepath.Join("testdata", "libraries", "SD")+"/")
+	require.Equal(t, sd, found)
+	require.Nil(t, findLibraryInFolder(libraries, filepath.Join("testdata", "libraries", "NoExamples")))
+
+	entry := indexEntryFromLibrary(found)
+	require.Equal(t, "SD", entry.LibraryName)
+	require.Equal(t, "1.2.2", entry.Version)
+	require.Equal(t, 0, indexJsonContains([]indexLibrary{entry}, sd.RealName, sd.Version))
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"arduino.cc/builder/types"
+)
+
+const SKETCH_TEMPLATE_INCLUDES = "{{includes}}"
+
+// Sketch compiled to discover the dependencies of a library when no
+// -sketch-template is given
+const DEFAULT_SKETCH_TEMPLATE = SKETCH_TEMPLATE_INCLUDES + "\nvoid loop(){}\nvoid setup(){}\n"
+
+func loadSketchTemplate(path string) (string, error) {
+	if path == "" {
+		return DEFAULT_SKETCH_TEMPLATE, nil
+	}
+	template, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return string(template), nil
+}
+
+// renderSketch substitutes the include lines computed for a library in the
+// sketch template
+func renderSketch(template string, includes string) string {
+	return strings.Replace(template, SKETCH_TEMPLATE_INCLUDES, includes, -1)
+}
+
+// sketchFileName is the name of the sketch generated for a library. It is
+// different for every library: the builder wipes the build folder when the
+// sketch name changes, so nothing built for a library is ever reused for the
+// next one sharing the same build folder.
+func sketchFileName(library *types.Library) string {
+	name := library.Name
+	if library.Version != "" {
+		name += "_" + library.Version
+	}
+	return "sketch_" + unsafeFolderChars.ReplaceAllString(name, "_") + ".ino"
+}
+
+// sketchFolder creates the folder the sketch of a library is generated in: a
+// new temporary folder or, with a work folder, <workDir>/<library>, emptied
+// first since any other sketch file in there would be compiled too
+func sketchFolder(workDir string, library *types.Library) (string, error) {
+	if workDir == "" {
+		return ioutil.TempDir("", "sketch"+library.Name)
+	}
+	folder := filepath.Join(workDir, unsafeFolderChars.ReplaceAllString(library.Name, "_"))
+	if err := os.RemoveAll(folder); err != nil {
+		return "", err
+	}
+	return folder, os.MkdirAll(folder, os.FileMode(0755))
+}
+
+// prependIncludes puts an #include line for every header before the include
+// lines of the library, in the given order. Headers can be given bare or
+// already quoted, as in <BoardConfig.h> or "config.h".
+func prependIncludes(headers []string, includes string) string {
+	prepended := ""
+	for _, header := range headers {
+		if !strings.HasPrefix(header, "<") && !strings.HasPrefix(header, "\"") {
+			header = "<" + header + ">"
+		}
+		prepended += "\n#include " + header
+	}
+	return prepended + includes
+}
+
+// prependDefines puts a #define line for every NAME or NAME=VALUE before
+// the include lines, so that the headers see them
+func prependDefines(defines []string, includes string) string {
+	prepended := ""
+	for _, define := range defines {
+		prepended += "\n#define " + strings.Replace(define, "=", " ", 1)
+	}
+	return prepended + includes
+}
+
+// dumpSketch keeps a copy of the sketch generated for a library, as
+// <folder>/<library>/sketch.ino
+func dumpSketch(folder string, library *types.Library, sketch string) error {
+	sketchFolder := filepath.Join(folder, realNameFolder(library))
+	if err := os.MkdirAll(sketchFolder, os.FileMode(0755)); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(sketchFolder, "sketch.ino"), []byte(sketch), 0666)
+}
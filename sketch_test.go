@@ -0,0 +1,68 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"arduino.cc/builder/types"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrependIncludes(t *testing.T) {
+	includes := prependIncludes([]string{"BoardConfig.h", "\"config.h\""}, "\n#include <SD.h>\n")
+	require.Equal(t, "\n#include <BoardConfig.h>\n#include \"config.h\"\n#include <SD.h>\n", includes)
+
+	require.Equal(t, "\n#include <SD.h>\n", prependIncludes(nil, "\n#include <SD.h>\n"))
+}
+
+func TestPrependDefines(t *testing.T) {
+	includes := prependDefines([]string{"USE_TINYUSB", "CFG_TUSB_MCU=OPT_MCU_SAMD21"}, "\n#include <BoardConfig.h>\n#include <SD.h>\n")
+	require.Equal(t, "\n#define USE_TINYUSB\n#define CFG_TUSB_MCU OPT_MCU_SAMD21\n#include <BoardConfig.h>\n#include <SD.h>\n", includes)
+
+	var defines definesFlag
+	require.NoError(t, defines.Set(" USE_TINYUSB=1 "))
+	require.Error(t, defines.Set("1BAD=1"))
+	require.Equal(t, definesFlag{"USE_TINYUSB=1"}, defines)
+}
+
+func TestDumpSketch(t *testing.T) {
+	folder, err := ioutil.TempDir("", "sketches")
+	require.NoError(t, err)
+	defer os.RemoveAll(folder)
+
+	library := &types.Library{Name: "SpacedName", RealName: "My Spaced Lib (fork)"}
+	require.NoError(t, dumpSketch(folder, library, "#include <SpacedName.h>\n"))
+
+	sketch, err := ioutil.ReadFile(filepath.Join(folder, "My_Spaced_Lib_fork_", "sketch.ino"))
+	require.NoError(t, err)
+	require.Equal(t, "#include <SpacedName.h>\n", string(sketch))
+}
+
+func TestSketchFileName(t *testing.T) {
+	require.Equal(t, "sketch_SD_1.2.2.ino", sketchFileName(&types.Library{Name: "SD", Version: "1.2.2"}))
+	require.Equal(t, "sketch_My_Spaced_Lib_fork_.ino", sketchFileName(&types.Library{Name: "My Spaced Lib (fork)"}))
+	require.NotEqual(t, sketchFileName(&types.Library{Name: "SD", Version: "1.2.2"}), sketchFileName(&types.Library{Name: "SD", Version: "1.2.3"}))
+}
+
+func TestSketchFolderInWorkDir(t *testing.T) {
+	workDir, err := ioutil.TempDir("", "work")
+	require.NoError(t, err)
+	defer os.RemoveAll(workDir)
+
+	library := &types.Library{Name: "My Lib", Version: "1.0.0"}
+	folder, err := sketchFolder(workDir, library)
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(workDir, "My_Lib"), folder)
+
+	// a sketch left by a previous run must not be compiled again
+	stale := filepath.Join(folder, "sketch_My_Lib_0.9.0.ino")
+	require.NoError(t, ioutil.WriteFile(stale, []byte{}, 0666))
+	folder, err = sketchFolder(workDir, library)
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(workDir, "My_Lib"), folder)
+	_, err = os.Stat(stale)
+	require.True(t, os.IsNotExist(err))
+}
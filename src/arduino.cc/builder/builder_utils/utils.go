@@ -365,6 +365,9 @@ func ExecRecipe(properties properties.Map, recipe string, removeUnsetProperties
 	}
 
 	command.Stderr = os.Stderr
+	if collector, ok := logger.(i18n.OutputCollector); ok {
+		command.Stderr = io.MultiWriter(os.Stderr, collector.Output())
+	}
 
 	if echoOutput {
 		err := command.Run()
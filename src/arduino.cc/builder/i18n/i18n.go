@@ -48,6 +48,13 @@ type Logger interface {
 	Name() string
 }
 
+// OutputCollector is a Logger which also wants a copy of the errors printed
+// by the commands the builder runs
+type OutputCollector interface {
+	Logger
+	Output() io.Writer
+}
+
 type NoopLogger struct{}
 
 func (s NoopLogger) Fprintln(w io.Writer, level string, format string, a ...interface{}) {}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"arduino.cc/builder/constants"
+)
+
+// starArchFQBNs returns the boards a library declaring the '*' architecture
+// is compiled for besides the primary one: one for every architecture listed
+// with -star-archs. Architectures without a known board are returned apart.
+func starArchFQBNs(name string, archs []string, starArchs []string, primary string) ([]string, []string) {
+	if len(archs) == 0 || archs[0] != constants.LIBRARY_ALL_ARCHS {
+		return nil, nil
+	}
+	var fqbns []string
+	var unknown []string
+	for _, arch := range starArchs {
+		fqbn, matched := resolveFQBN(name, []string{arch})
+		if !matched {
+			unknown = append(unknown, arch)
+			continue
+		}
+		if fqbn != primary && !sliceContainsFold(fqbns, fqbn) {
+			fqbns = append(fqbns, fqbn)
+		}
+	}
+	return fqbns, unknown
+}
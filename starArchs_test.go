@@ -0,0 +1,17 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStarArchFQBNs(t *testing.T) {
+	fqbns, unknown := starArchFQBNs("Servo", []string{"*"}, []string{"avr", "samd", "esp32", "sam"}, "arduino:avr:micro")
+	require.Equal(t, []string{"arduino:samd:mkr1000", "arduino:sam:arduino_due_x_dbg"}, fqbns)
+	require.Equal(t, []string{"esp32"}, unknown)
+
+	fqbns, unknown = starArchFQBNs("SD", []string{"avr", "samd"}, []string{"samd"}, "arduino:samd:mkr1000")
+	require.Empty(t, fqbns)
+	require.Empty(t, unknown)
+}
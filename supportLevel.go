@@ -0,0 +1,49 @@
+package main
+
+import (
+	"arduino.cc/builder/types"
+)
+
+const SUPPORT_LEVEL_VERIFIED = "verified"
+const SUPPORT_LEVEL_PARTIAL = "partial"
+const SUPPORT_LEVEL_BROKEN = "broken"
+
+// computeSupportLevel compiles the sketch at ctx.SketchLocation once for
+// every given architecture of a library, and tells whether it compiled on
+// all of them, on some or on none. Architectures without a known board are
+// not counted; if none is left the support level is unknown (empty). The
+// -library-fqbn-overrides are ignored, they'd pick the same board for every
+// architecture, and architectures sharing a board count once.
+func computeSupportLevel(ctx *types.Context, name string, archs []string) string {
+	fqbn := ctx.FQBN
+	defer func() { ctx.FQBN = fqbn }()
+
+	succeeded := 0
+	tried := 0
+	seen := make(map[string]bool)
+	for _, arch := range archs {
+		archFQBN, matched := resolveArchFQBN(name, []string{arch})
+		if !matched || seen[archFQBN] {
+			continue
+		}
+		seen[archFQBN] = true
+		tried++
+		ctx.FQBN = archFQBN
+		ctx.ImportedLibraries = ctx.ImportedLibraries[:0]
+		ctx.IncludeFolders = ctx.IncludeFolders[:0]
+		if runBuilderSafely(ctx) == nil {
+			succeeded++
+		}
+	}
+
+	switch {
+	case tried == 0:
+		return ""
+	case succeeded == tried:
+		return SUPPORT_LEVEL_VERIFIED
+	case succeeded > 0:
+		return SUPPORT_LEVEL_PARTIAL
+	default:
+		return SUPPORT_LEVEL_BROKEN
+	}
+}
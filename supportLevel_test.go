@@ -0,0 +1,29 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"arduino.cc/builder/types"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestComputeSupportLevelIgnoresOverrides(t *testing.T) {
+	defer func(original []fqbnOverride) { fqbnOverrides = original }(fqbnOverrides)
+	fqbnOverrides = []fqbnOverride{{Pattern: "Sensor*", FQBN: "arduino:avr:uno"}}
+	defer func(original func(*types.Context) error) { runBuilder = original }(runBuilder)
+	var built []string
+	runBuilder = func(ctx *types.Context) error {
+		built = append(built, ctx.FQBN)
+		if ctx.FQBN == "arduino:samd:mkr1000" {
+			return errors.New("exit status 1")
+		}
+		return nil
+	}
+
+	ctx := &types.Context{FQBN: "arduino:avr:uno"}
+	require.Equal(t, SUPPORT_LEVEL_PARTIAL, computeSupportLevel(ctx, "Sensor", []string{"avr", "samd", "avr"}))
+	require.Equal(t, []string{"arduino:avr:micro", "arduino:samd:mkr1000"}, built)
+	require.Equal(t, "arduino:avr:uno", ctx.FQBN)
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"arduino.cc/builder/types"
+)
+
+var unsafeFolderChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// realNameFolder is the name of the folder the library must live in to be
+// picked up by its RealName. Spaces and special characters are replaced, so
+// that the folder name is safe on every filesystem.
+func realNameFolder(library *types.Library) string {
+	return unsafeFolderChars.ReplaceAllString(library.RealName, "_")
+}
+
+// needsRealNameFolder tells if the library lives in a folder not named after
+// its RealName, so it must be presented to the builder under another folder
+func needsRealNameFolder(library *types.Library) bool {
+	return filepath.Join(filepath.Dir(library.Folder), realNameFolder(library)) != filepath.Clean(library.Folder)
+}
+
+// symlinkToRealName links the library folder to a sibling folder named after
+// its RealName, and returns the link. If the library already lives in such a
+// folder, no link is needed and "" is returned.
+func symlinkToRealName(library *types.Library) (string, error) {
+	if !needsRealNameFolder(library) {
+		return "", nil
+	}
+	symlinkWithBestName := filepath.Join(filepath.Dir(library.Folder), realNameFolder(library))
+	err := os.Symlink(library.Folder, symlinkWithBestName)
+	if err != nil {
+		return "", err
+	}
+	return symlinkWithBestName, nil
+}
+
+// isVersionedFolder tells if the library is installed in a folder named
+// after its version too, like SD-1.2.2. Several versions of a library may be
+// installed next to each other this way, and would all need the same link.
+func isVersionedFolder(library *types.Library) bool {
+	if library.Version == "" {
+		return false
+	}
+	base := filepath.Base(library.Folder)
+	for _, separator := range []string{"-", "_", "@"} {
+		if strings.HasSuffix(base, separator+library.Version) || strings.HasSuffix(base, separator+"v"+library.Version) {
+			return true
+		}
+	}
+	return false
+}
+
+// symlinkToPrivateFolder links the library folder, under its RealName, from
+// a new temporary libraries folder, and returns that libraries folder. Unlike
+// symlinkToRealName, nothing is added next to the library, so links to
+// different versions of the same library never collide.
+func symlinkToPrivateFolder(library *types.Library) (string, error) {
+	librariesFolder, err := ioutil.TempDir("", "versioned_libraries")
+	if err != nil {
+		return "", err
+	}
+	folder, err := filepath.Abs(library.Folder)
+	if err == nil {
+		err = os.Symlink(folder, filepath.Join(librariesFolder, realNameFolder(library)))
+	}
+	if err != nil {
+		os.RemoveAll(librariesFolder)
+		return "", err
+	}
+	return librariesFolder, nil
+}
+
+// removeStaleSymlink removes the link named after the RealName of the
+// library found next to it, if it points to the library folder: left behind
+// by an interrupted run, it would prevent linking the library again. No other
+// link is ever touched, and "" is returned if there was none to remove.
+func removeStaleSymlink(library *types.Library) (string, error) {
+	if !needsRealNameFolder(library) {
+		return "", nil
+	}
+	folder, err := filepath.Abs(library.Folder)
+	if err != nil {
+		return "", err
+	}
+	parent := filepath.Dir(library.Folder)
+	link := filepath.Join(parent, realNameFolder(library))
+	info, err := os.Lstat(link)
+	if err != nil || info.Mode()&os.ModeSymlink == 0 {
+		return "", nil
+	}
+	target, err := os.Readlink(link)
+	if err != nil {
+		return "", nil
+	}
+	resolved := target
+	if !filepath.IsAbs(resolved) {
+		resolved = filepath.Join(parent, resolved)
+	}
+	if resolved, err = filepath.Abs(resolved); err != nil {
+		return "", nil
+	}
+	if target != library.Folder && resolved != folder {
+		return "", nil
+	}
+	if err := os.Remove(link); err != nil {
+		return "", err
+	}
+	return link, nil
+}
+
+// File recording the symlinks created next to the libraries, kept in the
+// working directory like the cache while a run is in progress
+const CREATED_SYMLINKS_FILE = "created_symlinks.json"
+
+// symlinkRecord keeps track of the symlinks the tool created and didn't
+// remove yet, saving them to path (unless empty) so that the next run can
+// remove them if this one is interrupted. The file is removed once no link
+// is left. It's safe to use from several goroutines.
+type symlinkRecord struct {
+	mutex sync.Mutex
+	path  string
+	links map[string]bool
+}
+
+var createdSymlinks = &symlinkRecord{}
+
+func (r *symlinkRecord) add(link string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.links == nil {
+		r.links = make(map[string]bool)
+	}
+	if abs, err := filepath.Abs(link); err == nil {
+		link = abs
+	}
+	r.links[link] = true
+	r.save()
+}
+
+func (r *symlinkRecord) remove(link string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if abs, err := filepath.Abs(link); err == nil {
+		link = abs
+	}
+	delete(r.links, link)
+	r.save()
+}
+
+func (r *symlinkRecord) save() {
+	if r.path == "" {
+		return
+	}
+	if len(r.links) == 0 {
+		os.Remove(r.path)
+		return
+	}
+	var links []string
+	for link := range r.links {
+		links = append(links, link)
+	}
+	sort.Strings(links)
+	if err := writeJsonAtomically(r.path, links); err != nil {
+		fmt.Println("Cannot record the symlinks created: " + err.Error())
+	}
+}
+
+// sweepLeftoverSymlinks removes the symlinks an interrupted run recorded in
+// recordFile, then the file itself. Only links the tool created are touched:
+// a link installed on purpose is never removed, even if it looks like ours.
+func sweepLeftoverSymlinks(recordFile string) ([]string, error) {
+	data, err := ioutil.ReadFile(recordFile)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var links []string
+	if err := json.Unmarshal(data, &links); err != nil {
+		return nil, fmt.Errorf("invalid symlinks record %s: %s", recordFile, err)
+	}
+
+	var removed []string
+	for _, link := range links {
+		info, err := os.Lstat(link)
+		if err != nil || info.Mode()&os.ModeSymlink == 0 {
+			continue
+		}
+		if err := os.Remove(link); err != nil {
+			return removed, err
+		}
+		removed = append(removed, link)
+	}
+	return removed, os.Remove(recordFile)
+}
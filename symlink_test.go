@@ -0,0 +1,203 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"arduino.cc/builder/i18n"
+	"arduino.cc/builder/types"
+	"arduino.cc/properties"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSymlinkToRealNameWithSpaces(t *testing.T) {
+	librariesFolder, err := ioutil.TempDir("", "libraries with spaces")
+	require.NoError(t, err)
+	defer os.RemoveAll(librariesFolder)
+
+	folder := filepath.Join(librariesFolder, "SpacedName")
+	require.NoError(t, copyFolder(filepath.Join("testdata", "libraries", "SpacedName"), folder))
+	libProperties, err := properties.Load(filepath.Join(folder, "library.properties"), i18n.HumanLogger{})
+	require.NoError(t, err)
+	library := &types.Library{Name: "SpacedName", RealName: libProperties["name"], Folder: folder}
+
+	symlink, err := symlinkToRealName(library)
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(librariesFolder, "My_Spaced_Lib_fork_"), symlink)
+	_, err = os.Stat(filepath.Join(symlink, "src", "SpacedName.h"))
+	require.NoError(t, err)
+
+	dep := &types.Library{RealName: library.RealName, Folder: symlink}
+	require.True(t, isInFolder(dep.Folder, librariesFolder))
+	deps, internalDeps := appendDependencies([]*types.Library{dep}, &types.Library{RealName: "Other"}, librariesFolder, nil, nil, nil)
+	require.Equal(t, []string{"My Spaced Lib (fork)"}, deps)
+	require.Empty(t, internalDeps)
+
+	require.NoError(t, os.Remove(symlink))
+	_, err = os.Lstat(symlink)
+	require.True(t, os.IsNotExist(err))
+	_, err = os.Stat(folder)
+	require.NoError(t, err)
+}
+
+func TestSymlinkToRealNameNotNeeded(t *testing.T) {
+	library := &types.Library{RealName: "TemplateOnly", Folder: filepath.Join("testdata", "libraries", "TemplateOnly")}
+	require.False(t, needsRealNameFolder(library))
+	require.True(t, needsRealNameFolder(&types.Library{RealName: "Template Only", Folder: library.Folder}))
+
+	symlink, err := symlinkToRealName(library)
+	require.NoError(t, err)
+	require.Equal(t, "", symlink)
+}
+
+func TestIsInFolder(t *testing.T) {
+	require.True(t, isInFolder("/home/me/libraries/Foo", "/home/me/libraries"))
+	require.True(t, isInFolder("/home/me/libraries/Foo", "/home/me/libraries/"))
+	require.False(t, isInFolder("/home/me/libraries2/Foo", "/home/me/libraries"))
+	require.False(t, isInFolder("/opt/hardware/libraries/home/me/libraries", "/home/me/libraries"))
+
+	workingDir, err := os.Getwd()
+	require.NoError(t, err)
+	require.True(t, isInFolder(filepath.Join(workingDir, "testdata", "libraries", "SpacedName"), "testdata/libraries"))
+}
+
+func TestRemoveStaleSymlink(t *testing.T) {
+	librariesFolder, err := ioutil.TempDir("", "libraries")
+	require.NoError(t, err)
+	defer os.RemoveAll(librariesFolder)
+
+	folder := filepath.Join(librariesFolder, "SpacedName")
+	require.NoError(t, copyFolder(filepath.Join("testdata", "libraries", "SpacedName"), folder))
+	library := &types.Library{Name: "SpacedName", RealName: "My Spaced Lib (fork)", Folder: folder}
+
+	// left behind by an interrupted run
+	leftover := filepath.Join(librariesFolder, "My_Spaced_Lib_fork_")
+	require.NoError(t, os.Symlink(folder, leftover))
+	_, err = symlinkToRealName(library)
+	require.Error(t, err)
+	// another link to the same library, made on purpose: must survive
+	ownLink := filepath.Join(librariesFolder, "SpacedName_link")
+	require.NoError(t, os.Symlink(folder, ownLink))
+
+	removed, err := removeStaleSymlink(library)
+	require.NoError(t, err)
+	require.Equal(t, leftover, removed)
+	_, err = os.Lstat(ownLink)
+	require.NoError(t, err)
+
+	symlink, err := symlinkToRealName(library)
+	require.NoError(t, err)
+	require.Equal(t, leftover, symlink)
+}
+
+func TestRemoveStaleSymlinkInPlace(t *testing.T) {
+	librariesFolder, err := ioutil.TempDir("", "libraries")
+	require.NoError(t, err)
+	defer os.RemoveAll(librariesFolder)
+
+	folder := filepath.Join(librariesFolder, "SD")
+	require.NoError(t, copyFolder(filepath.Join("testdata", "libraries", "SD"), folder))
+	library := &types.Library{Name: "SD", RealName: "SD", Folder: folder}
+	link := filepath.Join(librariesFolder, "SD-1.2.2")
+	require.NoError(t, os.Symlink("SD", link))
+
+	removed, err := removeStaleSymlink(library)
+	require.NoError(t, err)
+	require.Empty(t, removed)
+	_, err = os.Lstat(link)
+	require.NoError(t, err)
+}
+
+func TestSweepLeftoverSymlinks(t *testing.T) {
+	librariesFolder, err := ioutil.TempDir("", "libraries")
+	require.NoError(t, err)
+	defer os.RemoveAll(librariesFolder)
+
+	folder := filepath.Join(librariesFolder, "SpacedName")
+	require.NoError(t, copyFolder(filepath.Join("testdata", "libraries", "SpacedName"), folder))
+	sdFolder := filepath.Join(librariesFolder, "SD-1.2.2")
+	require.NoError(t, copyFolder(filepath.Join("testdata", "libraries", "SD"), sdFolder))
+
+	record := &symlinkRecord{path: filepath.Join(librariesFolder, CREATED_SYMLINKS_FILE)}
+	leftover := filepath.Join(librariesFolder, "My_Spaced_Lib_fork_")
+	require.NoError(t, os.Symlink(folder, leftover))
+	record.add(leftover)
+	removedBefore := filepath.Join(librariesFolder, "Gone")
+	require.NoError(t, os.Symlink(folder, removedBefore))
+	record.add(removedBefore)
+	require.NoError(t, os.Remove(removedBefore))
+	// installed on purpose, exactly like a link of ours
+	installed := filepath.Join(librariesFolder, "SD")
+	require.NoError(t, os.Symlink(sdFolder, installed))
+
+	removed, err := sweepLeftoverSymlinks(record.path)
+	require.NoError(t, err)
+	require.Equal(t, []string{leftover}, removed)
+	_, err = os.Lstat(installed)
+	require.NoError(t, err)
+	_, err = os.Stat(record.path)
+	require.True(t, os.IsNotExist(err))
+
+	removed, err = sweepLeftoverSymlinks(record.path)
+	require.NoError(t, err)
+	require.Empty(t, removed)
+}
+
+func TestSymlinkRecordIsRemovedWhenEmpty(t *testing.T) {
+	folder, err := ioutil.TempDir("", "record")
+	require.NoError(t, err)
+	defer os.RemoveAll(folder)
+
+	record := &symlinkRecord{path: filepath.Join(folder, CREATED_SYMLINKS_FILE)}
+	record.add(filepath.Join(folder, "link"))
+	_, err = os.Stat(record.path)
+	require.NoError(t, err)
+	record.remove(filepath.Join(folder, "link"))
+	_, err = os.Stat(record.path)
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestSymlinkVersionedFolders(t *testing.T) {
+	librariesFolder, err := ioutil.TempDir("", "libraries")
+	require.NoError(t, err)
+	defer os.RemoveAll(librariesFolder)
+
+	var libraries []*types.Library
+	for _, version := range []string{"1.0.0", "1.1.0"} {
+		folder := filepath.Join(librariesFolder, "Versioned-"+version)
+		require.NoError(t, copyFolder(filepath.Join("testdata", "libraries", "Versioned-"+version), folder))
+		library := &types.Library{Name: "Versioned-" + version, RealName: "Versioned", Version: version, Folder: folder}
+		require.True(t, needsRealNameFolder(library))
+		require.True(t, isVersionedFolder(library))
+		libraries = append(libraries, library)
+	}
+	require.False(t, isVersionedFolder(&types.Library{RealName: "SD", Version: "1.2.2", Folder: filepath.Join("testdata", "libraries", "SD")}))
+
+	// a link next to the libraries can serve only one version at a time
+	symlink, err := symlinkToRealName(libraries[0])
+	require.NoError(t, err)
+	_, err = symlinkToRealName(libraries[1])
+	require.Error(t, err)
+	require.NoError(t, os.Remove(symlink))
+
+	var privateFolders []string
+	for _, library := range libraries {
+		privateFolder, err := symlinkToPrivateFolder(library)
+		require.NoError(t, err)
+		defer os.RemoveAll(privateFolder)
+		privateFolders = append(privateFolders, privateFolder)
+	}
+	require.NotEqual(t, privateFolders[0], privateFolders[1])
+	for idx, library := range libraries {
+		libProperties, err := properties.Load(filepath.Join(privateFolders[idx], "Versioned", "library.properties"), i18n.HumanLogger{})
+		require.NoError(t, err)
+		require.Equal(t, library.Version, libProperties["version"])
+	}
+
+	entries, err := ioutil.ReadDir(librariesFolder)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+}
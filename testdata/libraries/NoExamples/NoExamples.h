@@ -0,0 +1,4 @@
+#ifndef NO_EXAMPLES_H
+#define NO_EXAMPLES_H
+
+#endif
@@ -0,0 +1,4 @@
+#ifndef FATFILE_H
+#define FATFILE_H
+
+#endif
@@ -0,0 +1,4 @@
+#ifndef SD_H
+#define SD_H
+
+#endif
@@ -0,0 +1,4 @@
+#ifndef SDFAT_H
+#define SDFAT_H
+
+#endif
@@ -0,0 +1,4 @@
+#ifndef SPACED_NAME_H
+#define SPACED_NAME_H
+
+#endif
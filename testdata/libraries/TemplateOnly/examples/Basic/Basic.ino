@@ -0,0 +1,11 @@
+#include <Wire.h>
+#include <TemplateOnly.h>
+
+TemplateOnly<TwoWire> device(Wire);
+
+void setup() {
+  device.begin();
+}
+
+void loop() {
+}
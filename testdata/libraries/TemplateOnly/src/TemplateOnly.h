@@ -0,0 +1,14 @@
+#ifndef TEMPLATE_ONLY_H
+#define TEMPLATE_ONLY_H
+
+template <class Bus>
+class TemplateOnly {
+public:
+  TemplateOnly(Bus &bus) : bus(bus) {}
+  void begin() { bus.begin(); }
+
+private:
+  Bus &bus;
+};
+
+#endif
@@ -0,0 +1,4 @@
+#ifndef VERSIONED_H
+#define VERSIONED_H
+
+#endif
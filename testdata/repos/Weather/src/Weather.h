@@ -0,0 +1,4 @@
+#ifndef WEATHER_H
+#define WEATHER_H
+
+#endif
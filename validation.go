@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"arduino.cc/builder"
+	textdistance "github.com/masatana/go-textdistance"
+)
+
+// findDuplicateEntries returns the (name, version) pairs appearing more than
+// once in the index: only the first of them would ever get updated.
+func findDuplicateEntries(libraries []indexLibrary) []indexEntryRef {
+	seen := make(map[indexEntryRef]int)
+	var duplicates []indexEntryRef
+	for _, lib := range libraries {
+		ref := indexEntryRef{Name: lib.LibraryName, Version: lib.Version}
+		seen[ref]++
+		if seen[ref] == 2 {
+			duplicates = append(duplicates, ref)
+		}
+	}
+	return duplicates
+}
+
+func printDuplicateEntries(duplicates []indexEntryRef) {
+	for _, ref := range duplicates {
+		fmt.Println("Warning: " + ref.Name + " " + ref.Version + " appears more than once in the index, only the first entry will be updated")
+	}
+}
+
+// findDisallowedLicenses returns the index entries whose license is missing
+// or not in the allowed ones, compared case insensitively
+func findDisallowedLicenses(libraries []indexLibrary, allowed []string) []indexLibrary {
+	var disallowed []indexLibrary
+	for _, lib := range libraries {
+		if !sliceContainsFold(allowed, strings.TrimSpace(lib.License)) {
+			disallowed = append(disallowed, lib)
+		}
+	}
+	return disallowed
+}
+
+func printDisallowedLicenses(disallowed []indexLibrary) {
+	for _, lib := range disallowed {
+		if strings.TrimSpace(lib.License) == "" {
+			fmt.Println("Warning: " + lib.LibraryName + " " + lib.Version + " declares no license")
+		} else {
+			fmt.Println("Warning: " + lib.LibraryName + " " + lib.Version + " has license " + lib.License + ", which is not allowed")
+		}
+	}
+}
+
+// Category typos closer than this to a valid category are fixed by
+// -fix-categories
+const CATEGORY_MAX_TYPO_DISTANCE = 2
+
+type invalidCategory struct {
+	indexEntryRef
+	Category   string
+	Suggestion string
+}
+
+// findInvalidCategories returns the index entries whose category is not one
+// of those known to the Library Manager, with the category they most likely
+// meant, if any
+func findInvalidCategories(libraries []indexLibrary) []invalidCategory {
+	var invalid []invalidCategory
+	for _, lib := range libraries {
+		if builder.LIBRARY_CATEGORIES[lib.Category] {
+			continue
+		}
+		invalid = append(invalid, invalidCategory{
+			indexEntryRef: indexEntryRef{Name: lib.LibraryName, Version: lib.Version},
+			Category:      lib.Category,
+			Suggestion:    suggestCategory(lib.Category),
+		})
+	}
+	return invalid
+}
+
+// suggestCategory returns the valid category closest to category, if it
+// only differs by case, spacing or a small typo, or "" otherwise
+func suggestCategory(category string) string {
+	category = strings.ToLower(strings.Join(strings.Fields(category), " "))
+	if category == "" {
+		return ""
+	}
+	var categories []string
+	for valid := range builder.LIBRARY_CATEGORIES {
+		categories = append(categories, valid)
+	}
+	sort.Strings(categories)
+
+	suggestion := ""
+	best := CATEGORY_MAX_TYPO_DISTANCE + 1
+	for _, valid := range categories {
+		distance := textdistance.LevenshteinDistance(category, strings.ToLower(valid))
+		if distance < best {
+			best = distance
+			suggestion = valid
+		}
+	}
+	return suggestion
+}
+
+func printInvalidCategories(invalid []invalidCategory) {
+	for _, entry := range invalid {
+		message := "Warning: " + entry.Name + " " + entry.Version + " has invalid category '" + entry.Category + "'"
+		if entry.Suggestion != "" {
+			message += ", did you mean '" + entry.Suggestion + "'?"
+		}
+		fmt.Println(message)
+	}
+}
+
+// fixCategories replaces the invalid categories which have a suggestion
+func fixCategories(libraries []indexLibrary, invalid []invalidCategory) {
+	for _, entry := range invalid {
+		if entry.Suggestion == "" {
+			continue
+		}
+		for idx := range libraries {
+			if libraries[idx].LibraryName == entry.Name && libraries[idx].Version == entry.Version && libraries[idx].Category == entry.Category {
+				libraries[idx].Category = entry.Suggestion
+			}
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFindDuplicateEntries(t *testing.T) {
+	libraries := []indexLibrary{
+		{LibraryName: "Servo", Version: "1.0.0"},
+		{LibraryName: "Servo", Version: "1.1.0"},
+		{LibraryName: "Servo", Version: "1.0.0"},
+		{LibraryName: "Servo", Version: "1.0.0"},
+		{LibraryName: "SD", Version: "1.0.0"},
+	}
+
+	require.Equal(t, []indexEntryRef{{Name: "Servo", Version: "1.0.0"}}, findDuplicateEntries(libraries))
+	require.Empty(t, findDuplicateEntries(libraries[:2]))
+}
+
+func TestFindDisallowedLicenses(t *testing.T) {
+	libraries := []indexLibrary{
+		{LibraryName: "Servo", License: "MIT"},
+		{LibraryName: "SD", License: "gpl-3.0"},
+		{LibraryName: "Wire", License: " apache-2.0 "},
+		{LibraryName: "Unknown"},
+	}
+
+	disallowed := findDisallowedLicenses(libraries, []string{"MIT", "Apache-2.0"})
+	require.Equal(t, []indexLibrary{libraries[1], libraries[3]}, disallowed)
+}
+
+func TestFindInvalidCategories(t *testing.T) {
+	libraries := []indexLibrary{
+		{LibraryName: "Servo", Version: "1.0.0", Category: "Device Control"},
+		{LibraryName: "SD", Version: "1.0.0", Category: "data  storage"},
+		{LibraryName: "GFX", Version: "1.0.0", Category: "Dispaly"},
+		{LibraryName: "Blink", Version: "1.0.0", Category: "Fun"},
+		{LibraryName: "Empty", Version: "1.0.0"},
+	}
+
+	invalid := findInvalidCategories(libraries)
+	require.Equal(t, []invalidCategory{
+		{indexEntryRef: indexEntryRef{Name: "SD", Version: "1.0.0"}, Category: "data  storage", Suggestion: "Data Storage"},
+		{indexEntryRef: indexEntryRef{Name: "GFX", Version: "1.0.0"}, Category: "Dispaly", Suggestion: "Display"},
+		{indexEntryRef: indexEntryRef{Name: "Blink", Version: "1.0.0"}, Category: "Fun"},
+		{indexEntryRef: indexEntryRef{Name: "Empty", Version: "1.0.0"}},
+	}, invalid)
+
+	fixCategories(libraries, invalid)
+	require.Equal(t, "Data Storage", libraries[1].Category)
+	require.Equal(t, "Display", libraries[2].Category)
+	require.Equal(t, "Fun", libraries[3].Category)
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+)
+
+type checksumMismatch struct {
+	indexEntryRef
+	Expected string
+	Actual   string
+}
+
+// verifyChecksums downloads the archive of every library of the index, jobs
+// at a time, and compares it with the checksum recorded in the index. It
+// returns the mismatches and the libraries which could not be verified, in
+// index order.
+func verifyChecksums(libraries []indexLibrary, downloader *archiveDownloader, jobs int) ([]checksumMismatch, []indexEntryRef) {
+	if jobs < 1 {
+		jobs = 1
+	}
+	type result struct {
+		mismatch   *checksumMismatch
+		unverified bool
+	}
+	results := make([]result, len(libraries))
+
+	queue := make(chan int)
+	var wg sync.WaitGroup
+	for job := 0; job < jobs; job++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range queue {
+				mismatch, err := verifyChecksum(libraries[idx], downloader)
+				if err != nil {
+					fmt.Println("Cannot verify " + libraries[idx].LibraryName + " " + libraries[idx].Version + ": " + err.Error())
+				}
+				results[idx] = result{mismatch: mismatch, unverified: err != nil}
+			}
+		}()
+	}
+	for idx, lib := range libraries {
+		if lib.URL != "" && lib.Checksum != "" {
+			queue <- idx
+		}
+	}
+	close(queue)
+	wg.Wait()
+
+	var mismatches []checksumMismatch
+	var unverified []indexEntryRef
+	for idx, result := range results {
+		if result.mismatch != nil {
+			mismatches = append(mismatches, *result.mismatch)
+		}
+		if result.unverified {
+			unverified = append(unverified, indexEntryRef{Name: libraries[idx].LibraryName, Version: libraries[idx].Version})
+		}
+	}
+	return mismatches, unverified
+}
+
+func verifyChecksum(lib indexLibrary, downloader *archiveDownloader) (*checksumMismatch, error) {
+	archive, err := downloader.download(lib.URL)
+	if err != nil {
+		return nil, err
+	}
+	actual, ok, err := verifyFileChecksum(archive, lib.Checksum)
+	if err != nil || ok {
+		return nil, err
+	}
+	return &checksumMismatch{
+		indexEntryRef: indexEntryRef{Name: lib.LibraryName, Version: lib.Version},
+		Expected:      lib.Checksum,
+		Actual:        actual,
+	}, nil
+}
+
+func printChecksumMismatches(mismatches []checksumMismatch) {
+	for _, mismatch := range mismatches {
+		fmt.Println("Checksum mismatch for " + mismatch.Name + " " + mismatch.Version + ": index says " + mismatch.Expected + ", archive is " + mismatch.Actual)
+	}
+}
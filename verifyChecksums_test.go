@@ -0,0 +1,82 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifyChecksums(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing.zip" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte("abc"))
+	}))
+	defer server.Close()
+
+	cacheFolder, err := ioutil.TempDir("", "archives")
+	require.NoError(t, err)
+	defer os.RemoveAll(cacheFolder)
+	downloader, err := newArchiveDownloader(cacheFolder, 10*time.Second)
+	require.NoError(t, err)
+
+	libraries := []indexLibrary{
+		{LibraryName: "Good", Version: "1.0.0", URL: server.URL + "/Good-1.0.0.zip", Checksum: "SHA-256:ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"},
+		{LibraryName: "Bad", Version: "1.0.0", URL: server.URL + "/Bad-1.0.0.zip", Checksum: "SHA-256:0000"},
+		{LibraryName: "Missing", Version: "1.0.0", URL: server.URL + "/missing.zip", Checksum: "SHA-256:0000"},
+		{LibraryName: "Local", Version: "1.0.0"},
+	}
+
+	mismatches, unverified := verifyChecksums(libraries, downloader, 2)
+	require.Equal(t, []checksumMismatch{{
+		indexEntryRef: indexEntryRef{Name: "Bad", Version: "1.0.0"},
+		Expected:      "SHA-256:0000",
+		Actual:        "SHA-256:ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad",
+	}}, mismatches)
+	require.Equal(t, []indexEntryRef{{Name: "Missing", Version: "1.0.0"}}, unverified)
+
+	// the second time the archives come from the cache
+	server.Close()
+	mismatches, _ = verifyChecksums(libraries[:2], downloader, 2)
+	require.Len(t, mismatches, 1)
+}
+
+func TestDownloadRetriesServerErrors(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests < 3 || r.URL.Path == "/Other-1.0.0.zip" {
+			http.Error(w, "try later", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("abc"))
+	}))
+	defer server.Close()
+
+	cacheFolder, err := ioutil.TempDir("", "archives")
+	require.NoError(t, err)
+	defer os.RemoveAll(cacheFolder)
+	downloader, err := newArchiveDownloader(cacheFolder, 10*time.Second)
+	require.NoError(t, err)
+	downloader.retryDelay = 0
+
+	archive, err := downloader.download(server.URL + "/Lib-1.0.0.zip")
+	require.NoError(t, err)
+	require.Equal(t, 3, requests)
+	data, err := ioutil.ReadFile(archive)
+	require.NoError(t, err)
+	require.Equal(t, "abc", string(data))
+
+	// gives up after DOWNLOAD_RETRIES retries
+	requests = 0
+	_, err = downloader.download(server.URL + "/Other-1.0.0.zip")
+	require.Error(t, err)
+	require.Equal(t, DOWNLOAD_RETRIES+1, requests)
+}
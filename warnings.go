@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+)
+
+// Categories of the validation warnings, which fail the run with -strict
+const WARNING_DUPLICATE_ENTRY = "duplicate index entry"
+const WARNING_INVALID_CATEGORY = "invalid category"
+const WARNING_DISALLOWED_LICENSE = "disallowed license"
+const WARNING_CHECKSUM_MISMATCH = "checksum mismatch"
+const WARNING_UNVERIFIED_CHECKSUM = "unverified checksum"
+const WARNING_UNMATCHED_ENTRY = "unmatched index entry"
+const WARNING_DEPENDENCY_NOT_IN_INDEX = "dependency not in index"
+const WARNING_DEPS_DELTA_EXCEEDED = "dependencies delta exceeded"
+const WARNING_LIBRARIES_FOLDER_CHANGED = "libraries folder changed"
+const WARNING_UNDECLARED_DEPENDENCY = "dependency not declared"
+const WARNING_UNUSED_DEPENDENCY = "declared dependency not used"
+const WARNING_BOARD_NOT_INSTALLED = "board not installed"
+const WARNING_NO_SOURCES = "library without sources"
+const WARNING_DUPLICATE_LIBRARY = "library installed twice"
+
+// warningCollector counts the validation warnings emitted during a run, by
+// category. It's safe to use from several goroutines.
+type warningCollector struct {
+	mutex  sync.Mutex
+	counts map[string]int
+}
+
+var warnings warningCollector
+
+func (w *warningCollector) add(category string, count int) {
+	if count <= 0 {
+		return
+	}
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.counts == nil {
+		w.counts = make(map[string]int)
+	}
+	w.counts[category] += count
+}
+
+func (w *warningCollector) total() int {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	total := 0
+	for _, count := range w.counts {
+		total += count
+	}
+	return total
+}
+
+func (w *warningCollector) printSummary() {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	var categories []string
+	total := 0
+	for category, count := range w.counts {
+		categories = append(categories, category)
+		total += count
+	}
+	sort.Strings(categories)
+	fmt.Println(fmt.Sprint(total) + " validation warnings:")
+	for _, category := range categories {
+		fmt.Println("  " + category + ": " + fmt.Sprint(w.counts[category]))
+	}
+}
+
+// exitIfStrict fails the run if any validation warning was emitted and
+// -strict was given
+func exitIfStrict(stopProfiling func()) {
+	if !*strictFlag || warnings.total() == 0 {
+		return
+	}
+	warnings.printSummary()
+	if stopProfiling != nil {
+		stopProfiling()
+	}
+	os.Exit(1)
+}
@@ -0,0 +1,20 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWarningCollector(t *testing.T) {
+	var collector warningCollector
+	require.Equal(t, 0, collector.total())
+
+	collector.add(WARNING_DUPLICATE_ENTRY, 2)
+	collector.add(WARNING_INVALID_CATEGORY, 0)
+	collector.add(WARNING_DUPLICATE_ENTRY, 1)
+	collector.add(WARNING_UNMATCHED_ENTRY, 4)
+
+	require.Equal(t, 7, collector.total())
+	require.Equal(t, map[string]int{WARNING_DUPLICATE_ENTRY: 3, WARNING_UNMATCHED_ENTRY: 4}, collector.counts)
+}